@@ -0,0 +1,126 @@
+// Package asr defines the speech recognizer interface used by ION servers
+// and a registry of named backends.
+package asr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ion/audio"
+)
+
+var ErrUnknownBackend = errors.New("asr: unknown backend")
+
+// Recognizer transcribes one utterance. Partial may run concurrently with
+// Write and Final; those are never called concurrently with each other.
+type Recognizer interface {
+	// Write adds audio in Options.Format. Chunks may split frames.
+	Write(pcm []byte) error
+	// Partial returns a hypothesis for the audio so far, or "" if there
+	// is none yet.
+	Partial(ctx context.Context) (string, error)
+	// Final returns the transcript of all audio written. The Recognizer
+	// must not be written to afterwards.
+	Final(ctx context.Context) (string, error)
+	Close() error
+}
+
+type Options struct {
+	Format   audio.Format
+	Language string // empty to detect
+	Prompt   string // text to bias recognition, if the backend supports it
+
+	// Params holds backend settings such as model paths; each backend
+	// documents the keys it reads.
+	Params map[string]string
+}
+
+// Param returns Params[key], or def if it is unset.
+func (o Options) Param(key, def string) string {
+	if v, ok := o.Params[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// DurationParam parses Params[key] as a time.Duration.
+func (o Options) DurationParam(key string, def time.Duration) (time.Duration, error) {
+	v, ok := o.Params[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		if n, nerr := strconv.ParseFloat(v, 64); nerr == nil {
+			return time.Duration(n * float64(time.Second)), nil
+		}
+		return 0, fmt.Errorf("asr: param %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// Factory creates a Recognizer for one utterance.
+type Factory func(ctx context.Context, opts Options) (Recognizer, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("mock", newMock)
+	Register("whisper-cli", newWhisperCLI)
+	Register("whisper", newWhisperCLI)
+	Register("whisper-server", newWhisperServer)
+}
+
+// Register makes a backend available to New under name. Registering a
+// name twice panics.
+func Register(name string, f Factory) {
+	if name == "" || f == nil {
+		panic("asr: Register with empty name or nil factory")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("asr: backend %q already registered", name))
+	}
+	registry[name] = f
+}
+
+// Backends lists the registered backend names.
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Known reports whether a backend is registered under name.
+func Known(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := registry[name]
+	return ok
+}
+
+// New starts a Recognizer from the named backend.
+func New(ctx context.Context, name string, opts Options) (Recognizer, error) {
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+	opts.Format = opts.Format.WithDefaults()
+	return f(ctx, opts)
+}
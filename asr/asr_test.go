@@ -0,0 +1,127 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"ion/audio"
+	"ion/audio/wav"
+	"ion/protocol"
+)
+
+func TestRegistry(t *testing.T) {
+	for _, name := range []string{"mock", "whisper", "whisper-cli"} {
+		if !slices.Contains(Backends(), name) || !Known(name) {
+			t.Errorf("backend %q not registered", name)
+		}
+	}
+	if _, err := New(context.Background(), "nope", Options{}); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("unknown backend: got %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate Register did not panic")
+		}
+	}()
+	Register("mock", newMock)
+}
+
+func TestMock(t *testing.T) {
+	ctx := context.Background()
+	r, err := New(ctx, "mock", Options{Params: map[string]string{"text": "turn on the lights", "partial": "turn on"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if p, _ := r.Partial(ctx); p != "" {
+		t.Errorf("partial before audio: %q", p)
+	}
+	if err := r.Write(make([]byte, 640)); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := r.Partial(ctx); p != "turn on" {
+		t.Errorf("partial %q", p)
+	}
+	if text, _ := r.Final(ctx); text != "turn on the lights" {
+		t.Errorf("final %q", text)
+	}
+	if err := r.Write(make([]byte, 640)); err == nil {
+		t.Error("write after final succeeded")
+	}
+}
+
+func TestWhisperCLI(t *testing.T) {
+	dir := t.TempDir()
+	cli := filepath.Join(dir, "whisper-cli")
+	script := `#!/bin/sh
+cp "$4" "` + dir + `/in.wav"
+echo "whisper_init_from_file: loading model from '$2'"
+echo "system_info: n_threads = 4"
+echo
+echo " hello world"
+echo "whisper_print_timings: total time = 1.00 ms"
+`
+	if err := os.WriteFile(cli, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := New(ctx, "whisper-cli", Options{Params: map[string]string{"cli": cli}}); err == nil {
+		t.Fatal("missing model accepted")
+	}
+	format := audio.Format{SampleRate: 48000, Channels: 2, Encoding: protocol.FormatS16LE}
+	r, err := New(ctx, "whisper-cli", Options{
+		Format: format,
+		Params: map[string]string{"cli": cli, "model": "ggml-tiny.bin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	second := make([]byte, format.SampleRate*format.FrameSize())
+	for i := 0; i < len(second); i += 1001 {
+		if err := r.Write(second[i:min(i+1001, len(second))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if text, err := r.Partial(ctx); err != nil || text != "hello world" {
+		t.Fatalf("partial %q, %v", text, err)
+	}
+	if text, _ := r.Partial(ctx); text != "" {
+		t.Errorf("repeated partial without new audio: %q", text)
+	}
+	text, err := r.Final(ctx)
+	if err != nil || text != "hello world" {
+		t.Fatalf("final %q, %v", text, err)
+	}
+
+	in, err := wav.Open(filepath.Join(dir, "in.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	h := in.Header()
+	if h.SampleRate != 16000 || h.Channels != 1 || h.Format != protocol.FormatS16LE {
+		t.Fatalf("whisper got %+v", h)
+	}
+	pcm, err := io.ReadAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm) != 16000*2 {
+		t.Fatalf("whisper got %d bytes, want one second", len(pcm))
+	}
+}
+
+func TestExtractTranscript(t *testing.T) {
+	out := "whisper_init: ok\nmain: processing\n[00:00:00.000 --> 00:00:02.000]  timed\n\n  what time is it \nwhisper_print_timings: x\n"
+	if got := extractTranscript(out); got != "what time is it" {
+		t.Fatalf("got %q", got)
+	}
+}
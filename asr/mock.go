@@ -0,0 +1,47 @@
+package asr
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// The mock backend answers with fixed text and is useful for wiring and
+// protocol tests. Params:
+//
+//	text     final transcript (default "demo transcript (replace with Whisper)")
+//	partial  partial hypothesis once audio has arrived (default none)
+type mock struct {
+	text, partial string
+	bytes         atomic.Int64
+	done          bool
+}
+
+func newMock(_ context.Context, opts Options) (Recognizer, error) {
+	return &mock{
+		text:    opts.Param("text", "demo transcript (replace with Whisper)"),
+		partial: opts.Param("partial", ""),
+	}, nil
+}
+
+func (m *mock) Write(pcm []byte) error {
+	if m.done {
+		return fmt.Errorf("asr: write after final")
+	}
+	m.bytes.Add(int64(len(pcm)))
+	return nil
+}
+
+func (m *mock) Partial(context.Context) (string, error) {
+	if m.bytes.Load() == 0 {
+		return "", nil
+	}
+	return m.partial, nil
+}
+
+func (m *mock) Final(context.Context) (string, error) {
+	m.done = true
+	return m.text, nil
+}
+
+func (m *mock) Close() error { return nil }
@@ -0,0 +1,110 @@
+package asr
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ion/audio"
+	"ion/audio/wav"
+	"ion/protocol"
+)
+
+// whisperFormat is what whisper.cpp expects.
+var whisperFormat = audio.Format{SampleRate: 16000, Channels: 1, Encoding: protocol.FormatS16LE}
+
+// transcribeFunc turns whisperFormat PCM into text. Partials are best
+// effort, so a backend may return "" for them when it is busy.
+type transcribeFunc func(ctx context.Context, pcm []byte, final bool) (string, error)
+
+// whisper buffers audio for the whisper.cpp backends. Params shared by
+// all of them:
+//
+//	partial_window  audio transcribed for partials (default 6s)
+//	max_audio       audio kept for the final transcript (default 30s)
+type whisper struct {
+	transcribe transcribeFunc
+	window     int // bytes of whisperFormat
+	maxAudio   int
+
+	mu          sync.Mutex
+	conv        *audio.Converter
+	pcm         []byte
+	partialSize int // len(pcm) at the last partial
+}
+
+func newWhisper(opts Options, transcribe transcribeFunc) (*whisper, error) {
+	window, err := opts.DurationParam("partial_window", 6*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	maxAudio, err := opts.DurationParam("max_audio", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conv, err := audio.NewConverter(opts.Format, whisperFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &whisper{
+		transcribe: transcribe,
+		window:     whisperBytes(window),
+		maxAudio:   whisperBytes(maxAudio),
+		conv:       conv,
+	}, nil
+}
+
+func whisperBytes(d time.Duration) int {
+	return int(d.Seconds()*float64(whisperFormat.SampleRate)) * whisperFormat.FrameSize()
+}
+
+func whisperWAV(pcm []byte) ([]byte, error) {
+	return wav.Encode(wav.Header{SampleRate: whisperFormat.SampleRate, Channels: whisperFormat.Channels, Format: whisperFormat.Encoding}, pcm)
+}
+
+func (w *whisper) Write(pcm []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	w.pcm, err = w.conv.Convert(w.pcm, pcm)
+	if err != nil {
+		return err
+	}
+	if w.maxAudio > 0 && len(w.pcm) > w.maxAudio {
+		drop := len(w.pcm) - w.maxAudio
+		w.pcm = append(w.pcm[:0], w.pcm[drop:]...)
+		w.partialSize = max(0, w.partialSize-drop)
+	}
+	return nil
+}
+
+// Partial transcribes the most recent window once at least half a second
+// of audio has arrived, and only if there is new audio since last time.
+func (w *whisper) Partial(ctx context.Context) (string, error) {
+	w.mu.Lock()
+	if len(w.pcm) < whisperBytes(500*time.Millisecond) || len(w.pcm) == w.partialSize {
+		w.mu.Unlock()
+		return "", nil
+	}
+	w.partialSize = len(w.pcm)
+	window := w.pcm
+	if w.window > 0 && len(window) > w.window {
+		window = window[len(window)-w.window:]
+	}
+	window = append([]byte(nil), window...)
+	w.mu.Unlock()
+	return w.transcribe(ctx, window, false)
+}
+
+func (w *whisper) Final(ctx context.Context) (string, error) {
+	w.mu.Lock()
+	pcm, err := w.conv.Flush(w.pcm)
+	w.pcm = nil
+	w.mu.Unlock()
+	if err != nil || len(pcm) == 0 {
+		return "", err
+	}
+	return w.transcribe(ctx, pcm, true)
+}
+
+func (w *whisper) Close() error { return nil }
@@ -0,0 +1,91 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The whisper-cli backend runs whisper.cpp's command line tool on a
+// temporary WAV file for each partial and final transcript, reloading the
+// model every time. Params, besides those of whisper:
+//
+//	cli    path to whisper-cli (default "whisper-cli")
+//	model  path to the ggml model (required)
+type whisperCLI struct {
+	cli, model   string
+	lang, prompt string
+}
+
+func newWhisperCLI(_ context.Context, opts Options) (Recognizer, error) {
+	c := &whisperCLI{
+		cli:    opts.Param("cli", "whisper-cli"),
+		model:  opts.Param("model", ""),
+		lang:   strings.TrimSpace(opts.Language),
+		prompt: opts.Prompt,
+	}
+	if c.model == "" {
+		return nil, errors.New("asr: whisper-cli needs a model")
+	}
+	return newWhisper(opts, c.run)
+}
+
+func (c *whisperCLI) run(ctx context.Context, pcm []byte, _ bool) (string, error) {
+	data, err := whisperWAV(pcm)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp("", "ion-whisper-*.wav")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"-m", c.model, "-f", tmpPath, "--no-timestamps"}
+	if c.lang != "" {
+		args = append(args, "-l", c.lang)
+	}
+	if c.prompt != "" {
+		args = append(args, "--prompt", c.prompt)
+	}
+	out, err := exec.CommandContext(ctx, c.cli, args...).CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			return "", fmt.Errorf("whisper exec: %w", err)
+		}
+		return "", fmt.Errorf("whisper exec: %w: %s", err, msg)
+	}
+	return extractTranscript(string(out)), nil
+}
+
+// extractTranscript picks the transcript out of whisper-cli's output,
+// skipping its log lines.
+func extractTranscript(output string) string {
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "whisper_") || strings.HasPrefix(line, "main:") || strings.HasPrefix(line, "system_info:") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.Contains(line, "-->") {
+			continue
+		}
+		return line
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package asr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultWhisperServerURL = "http://127.0.0.1:8080/inference"
+
+// The whisper-server backend posts audio to a running whisper.cpp server,
+// which keeps the model loaded between requests. Params, besides those of
+// whisper:
+//
+//	url          inference endpoint (default DefaultWhisperServerURL)
+//	timeout      limit for each request (default 30s)
+//	concurrency  requests in flight to url across all sessions (default 2)
+//
+// Requests to the same url share connections and the concurrency limit,
+// which the first session to use the url sets. When the limit is reached,
+// partials are skipped and finals wait their turn.
+type whisperServer struct {
+	url          string
+	lang, prompt string
+	timeout      time.Duration
+	pool         *serverPool
+}
+
+type serverPool struct {
+	client *http.Client
+	slots  chan struct{}
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = make(map[string]*serverPool)
+)
+
+func poolFor(url string, concurrency int) *serverPool {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if p, ok := pools[url]; ok {
+		return p
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = concurrency
+	p := &serverPool{
+		client: &http.Client{Transport: transport},
+		slots:  make(chan struct{}, concurrency),
+	}
+	pools[url] = p
+	return p
+}
+
+func newWhisperServer(_ context.Context, opts Options) (Recognizer, error) {
+	timeout, err := opts.DurationParam("timeout", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	concurrency, err := strconv.Atoi(opts.Param("concurrency", "2"))
+	if err != nil || concurrency < 1 {
+		return nil, fmt.Errorf("asr: bad concurrency %q", opts.Param("concurrency", ""))
+	}
+	url := opts.Param("url", DefaultWhisperServerURL)
+	s := &whisperServer{
+		url:     url,
+		lang:    strings.TrimSpace(opts.Language),
+		prompt:  opts.Prompt,
+		timeout: timeout,
+		pool:    poolFor(url, concurrency),
+	}
+	return newWhisper(opts, s.run)
+}
+
+func (s *whisperServer) run(ctx context.Context, pcm []byte, final bool) (string, error) {
+	if final {
+		select {
+		case s.pool.slots <- struct{}{}:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	} else {
+		select {
+		case s.pool.slots <- struct{}{}:
+		default:
+			return "", nil
+		}
+	}
+	defer func() { <-s.pool.slots }()
+
+	body, contentType, err := s.form(pcm)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.pool.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("whisper server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("whisper server: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("whisper server: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var result struct {
+		Text  string `json:"text"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("whisper server: %w", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("whisper server: %s", result.Error)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+func (s *whisperServer) form(pcm []byte) (io.Reader, string, error) {
+	data, err := whisperWAV(pcm)
+	if err != nil {
+		return nil, "", err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, "", err
+	}
+	fields := [][2]string{{"response_format", "json"}, {"temperature", "0.0"}}
+	if s.lang != "" {
+		fields = append(fields, [2]string{"language", s.lang})
+	}
+	if s.prompt != "" {
+		fields = append(fields, [2]string{"prompt", s.prompt})
+	}
+	for _, f := range fields {
+		if err := mw.WriteField(f[0], f[1]); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return &body, mw.FormDataContentType(), nil
+}
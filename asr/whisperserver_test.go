@@ -0,0 +1,197 @@
+package asr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ion/audio"
+	"ion/audio/wav"
+	"ion/protocol"
+)
+
+// fakeWhisperServer stands in for whisper.cpp's server. Each request
+// blocks until release yields, if set.
+type fakeWhisperServer struct {
+	*httptest.Server
+	release  chan struct{}
+	conns    atomic.Int32
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+
+	mu       sync.Mutex
+	language string
+	frames   int
+}
+
+func newFakeWhisperServer(t *testing.T) *fakeWhisperServer {
+	f := &fakeWhisperServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /inference", f.inference)
+	f.Server = httptest.NewUnstartedServer(mux)
+	f.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			f.conns.Add(1)
+		}
+	}
+	f.Start()
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeWhisperServer) inference(w http.ResponseWriter, r *http.Request) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		m := f.maxSeen.Load()
+		if n <= m || f.maxSeen.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	if f.release != nil {
+		select {
+		case <-f.release:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rd, err := wav.NewReader(file)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	pcm, _ := io.ReadAll(rd)
+	if h := rd.Header(); h.SampleRate != 16000 || h.Channels != 1 || r.FormValue("response_format") != "json" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.language = r.FormValue("language")
+	f.frames = len(pcm) / 2
+	f.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]string{"text": " hello world\n"})
+}
+
+func newServerRecognizer(t *testing.T, url string, params map[string]string) Recognizer {
+	t.Helper()
+	p := map[string]string{"url": url}
+	for k, v := range params {
+		p[k] = v
+	}
+	r, err := New(context.Background(), "whisper-server", Options{
+		Format:   audio.Format{SampleRate: 8000, Channels: 1, Encoding: protocol.FormatS16LE},
+		Language: "en",
+		Params:   p,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	if err := r.Write(make([]byte, 8000*2)); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestWhisperServer(t *testing.T) {
+	srv := newFakeWhisperServer(t)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		r := newServerRecognizer(t, srv.URL+"/inference", nil)
+		if text, err := r.Partial(ctx); err != nil || text != "hello world" {
+			t.Fatalf("partial %q, %v", text, err)
+		}
+		if text, err := r.Final(ctx); err != nil || text != "hello world" {
+			t.Fatalf("final %q, %v", text, err)
+		}
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.language != "en" || srv.frames != 16000 {
+		t.Errorf("server got language %q, %d frames", srv.language, srv.frames)
+	}
+	if n := srv.conns.Load(); n != 1 {
+		t.Errorf("%d connections for sequential requests, want 1", n)
+	}
+}
+
+func TestWhisperServerConcurrency(t *testing.T) {
+	srv := newFakeWhisperServer(t)
+	srv.release = make(chan struct{})
+	url := srv.URL + "/inference"
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		r := newServerRecognizer(t, url, map[string]string{"concurrency": "1"})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if text, err := r.Final(ctx); err != nil || text != "hello world" {
+				t.Errorf("final %q, %v", text, err)
+			}
+		}()
+	}
+	for srv.inFlight.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A partial does not queue behind the finals.
+	r := newServerRecognizer(t, url, nil)
+	if text, err := r.Partial(ctx); err != nil || text != "" {
+		t.Errorf("partial while busy: %q, %v", text, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		srv.release <- struct{}{}
+	}
+	wg.Wait()
+	if n := srv.maxSeen.Load(); n != 1 {
+		t.Errorf("%d requests in flight, want at most 1", n)
+	}
+}
+
+func TestWhisperServerErrors(t *testing.T) {
+	srv := newFakeWhisperServer(t)
+	srv.release = make(chan struct{})
+	ctx := context.Background()
+
+	r := newServerRecognizer(t, srv.URL+"/inference", map[string]string{"timeout": "50ms"})
+	start := time.Now()
+	if _, err := r.Final(ctx); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("slow server: got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("timeout took %v", time.Since(start))
+	}
+
+	r = newServerRecognizer(t, srv.URL+"/missing", nil)
+	close(srv.release)
+	if _, err := r.Final(ctx); err == nil {
+		t.Error("missing endpoint: no error")
+	}
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"error": "failed to read WAV file"}`))
+	}))
+	defer bad.Close()
+	r = newServerRecognizer(t, bad.URL, nil)
+	if _, err := r.Final(ctx); err == nil || !strings.Contains(err.Error(), "failed to read WAV") {
+		t.Errorf("error response: got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"ion/protocol"
+)
+
+// commandSource reads raw PCM from a child process's stdout.
+type commandSource struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	format Format
+
+	closeOnce sync.Once
+}
+
+func startCommand(f Format, name string, args ...string) (*commandSource, error) {
+	if f.FrameSize() == 0 {
+		return nil, fmt.Errorf("audio: unsupported encoding %q", f.Encoding)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandSource{cmd: cmd, stdout: out, format: f}, nil
+}
+
+func (s *commandSource) Read(p []byte) (int, error) {
+	return s.stdout.Read(p)
+}
+
+func (s *commandSource) Format() Format {
+	return s.format
+}
+
+func (s *commandSource) Close() error {
+	s.closeOnce.Do(func() {
+		_ = s.cmd.Process.Kill()
+		_ = s.cmd.Wait()
+	})
+	return nil
+}
+
+func openParec(device string, f Format) (Source, error) {
+	args := []string{
+		"--raw",
+		"--format", pulseFormat(f.Encoding),
+		"--rate", strconv.Itoa(f.SampleRate),
+		"--channels", strconv.Itoa(f.Channels),
+	}
+	if device != "" {
+		args = append(args, "--device", device)
+	}
+	return startCommand(f, "parec", args...)
+}
+
+func pulseFormat(encoding protocol.SampleFormat) string {
+	switch encoding {
+	case protocol.FormatF32LE:
+		return "float32le"
+	case protocol.FormatMulaw:
+		return "ulaw"
+	}
+	return string(encoding)
+}
+
+var alsaFormats = map[protocol.SampleFormat]string{
+	protocol.FormatU8:    "U8",
+	protocol.FormatS16LE: "S16_LE",
+	protocol.FormatS24LE: "S24_3LE",
+	protocol.FormatS32LE: "S32_LE",
+	protocol.FormatF32LE: "FLOAT_LE",
+	protocol.FormatMulaw: "MU_LAW",
+	protocol.FormatAlaw:  "A_LAW",
+}
+
+func openArecord(device string, f Format) (Source, error) {
+	enc, ok := alsaFormats[f.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("audio: arecord cannot capture %q", f.Encoding)
+	}
+	args := []string{
+		"-q", "-t", "raw",
+		"-f", enc,
+		"-r", strconv.Itoa(f.SampleRate),
+		"-c", strconv.Itoa(f.Channels),
+	}
+	if device != "" {
+		args = append(args, "-D", device)
+	}
+	return startCommand(f, "arecord", args...)
+}
+
+var pwFormats = map[protocol.SampleFormat]string{
+	protocol.FormatU8:    "u8",
+	protocol.FormatS16LE: "s16",
+	protocol.FormatS24LE: "s24",
+	protocol.FormatS32LE: "s32",
+	protocol.FormatF32LE: "f32",
+}
+
+func openPWRecord(target string, f Format) (Source, error) {
+	enc, ok := pwFormats[f.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("audio: pw-record cannot capture %q", f.Encoding)
+	}
+	args := []string{
+		"--raw",
+		"--format", enc,
+		"--rate", strconv.Itoa(f.SampleRate),
+		"--channels", strconv.Itoa(f.Channels),
+	}
+	if target != "" {
+		args = append(args, "--target", target)
+	}
+	args = append(args, "-")
+	return startCommand(f, "pw-record", args...)
+}
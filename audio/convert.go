@@ -0,0 +1,189 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+
+	"ion/audio/resample"
+	"ion/protocol"
+)
+
+// Converter turns a stream of PCM in one Format into another, converting
+// sample encoding, channel count (through a Matrix) and rate. It keeps state between calls,
+// so each stream needs its own Converter and chunks may split frames.
+type Converter struct {
+	from, to Format
+
+	matrix   Matrix
+	partial  []byte
+	samples  []float32
+	mixed    []float32
+	out      []float32
+	resample *resample.Resampler
+}
+
+func NewConverter(from, to Format) (*Converter, error) {
+	from, to = from.WithDefaults(), to.WithDefaults()
+	if from.FrameSize() == 0 || to.FrameSize() == 0 {
+		return nil, fmt.Errorf("audio: cannot convert %v to %v", from, to)
+	}
+	c := &Converter{from: from, to: to}
+	if from.Channels != to.Channels {
+		c.matrix = DefaultMatrix(from.Channels, to.Channels)
+	}
+	if from.SampleRate != to.SampleRate {
+		var err error
+		if c.resample, err = resample.New(from.SampleRate, to.SampleRate, to.Channels, resample.High); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Converter) From() Format { return c.from }
+func (c *Converter) To() Format   { return c.to }
+
+// SetMatrix replaces the default channel mix. It must match the channel
+// counts of both formats and be set before the first Convert.
+func (c *Converter) SetMatrix(m Matrix) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	if m.Inputs() != c.from.Channels || m.Outputs() != c.to.Channels {
+		return fmt.Errorf("%w: %dx%d matrix for %d to %d channels",
+			ErrBadMatrix, m.Outputs(), m.Inputs(), c.from.Channels, c.to.Channels)
+	}
+	c.matrix = m
+	return nil
+}
+
+// Identity reports whether Convert only copies.
+func (c *Converter) Identity() bool {
+	return c.from == c.to && c.matrix == nil
+}
+
+// Convert appends the converted form of pcm to dst. Bytes of an incomplete
+// trailing frame are held until the next call.
+func (c *Converter) Convert(dst, pcm []byte) ([]byte, error) {
+	frameSize := c.from.FrameSize()
+	if len(c.partial) > 0 {
+		c.partial = append(c.partial, pcm...)
+		pcm, c.partial = c.partial, nil
+	}
+	whole := len(pcm) / frameSize * frameSize
+	if whole < len(pcm) {
+		c.partial = append(c.partial[:0], pcm[whole:]...)
+		pcm = pcm[:whole]
+	}
+	if c.Identity() {
+		return append(dst, pcm...), nil
+	}
+
+	var err error
+	c.samples, err = protocol.DecodeSamples(c.samples[:0], c.from.Encoding, pcm)
+	if err != nil {
+		return dst, err
+	}
+	samples := c.samples
+	if c.matrix != nil {
+		c.mixed = c.matrix.Apply(c.mixed[:0], samples)
+		samples = c.mixed
+	}
+	if c.resample != nil {
+		c.out = c.resample.Process(c.out[:0], samples)
+		samples = c.out
+	}
+	return protocol.EncodeSamples(dst, c.to.Encoding, samples)
+}
+
+// Flush appends the output still held by the resampler at the end of a
+// stream and drops any incomplete input frame. The Converter can then be
+// reused for a new stream.
+func (c *Converter) Flush(dst []byte) ([]byte, error) {
+	c.partial = c.partial[:0]
+	if c.resample == nil {
+		return dst, nil
+	}
+	c.out = c.resample.Flush(c.out[:0])
+	return protocol.EncodeSamples(dst, c.to.Encoding, c.out)
+}
+
+// ConvertSource wraps src so it produces to. It returns src itself if the
+// formats already match.
+func ConvertSource(src Source, to Format) (Source, error) {
+	to = to.WithDefaults()
+	if src.Format() == to {
+		return src, nil
+	}
+	c, err := NewConverter(src.Format(), to)
+	if err != nil {
+		return nil, err
+	}
+	return &convertedSource{src: src, conv: c}, nil
+}
+
+// MixSource wraps src so its channels are mixed through m, keeping the
+// sample rate and encoding.
+func MixSource(src Source, m Matrix) (Source, error) {
+	to := src.Format()
+	to.Channels = m.Outputs()
+	c, err := NewConverter(src.Format(), to)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetMatrix(m); err != nil {
+		return nil, err
+	}
+	return &convertedSource{src: src, conv: c}, nil
+}
+
+type convertedSource struct {
+	src  Source
+	conv *Converter
+	in   []byte
+	out  []byte
+	err  error // from src, returned once out is drained
+}
+
+func (s *convertedSource) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		size := len(p) * s.conv.from.FrameSize() / s.conv.to.FrameSize()
+		if size < s.conv.from.FrameSize() {
+			size = s.conv.from.FrameSize()
+		}
+		if cap(s.in) < size {
+			s.in = make([]byte, size)
+		}
+		n, err := s.src.Read(s.in[:size])
+		if n > 0 {
+			out, cerr := s.conv.Convert(s.out[:0], s.in[:n])
+			if cerr != nil {
+				return 0, cerr
+			}
+			s.out = out
+		}
+		if err == io.EOF {
+			// Drain what the resampler holds back at the end.
+			out, ferr := s.conv.Flush(s.out)
+			if ferr != nil {
+				err = ferr
+			}
+			s.out = out
+		}
+		s.err = err
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+func (s *convertedSource) Format() Format {
+	return s.conv.to
+}
+
+func (s *convertedSource) Close() error {
+	return s.src.Close()
+}
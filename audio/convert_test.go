@@ -0,0 +1,89 @@
+package audio
+
+import (
+	"io"
+	"math"
+	"testing"
+
+	"ion/protocol"
+)
+
+func TestConverterChunked(t *testing.T) {
+	from := Format{SampleRate: 48000, Channels: 2, Encoding: protocol.FormatF32LE}
+	to := Format{SampleRate: 16000, Channels: 1, Encoding: protocol.FormatS16LE}
+	src, err := OpenSynth("sine?freq=440&amp=0.5&duration=1s&realtime=false", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, _ := io.ReadAll(src)
+
+	conv, err := NewConverter(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []byte
+	// Odd chunk sizes split samples and frames.
+	for i := 0; i < len(in); i += 1001 {
+		end := min(i+1001, len(in))
+		if out, err = conv.Convert(out, in[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out, err = conv.Flush(out); err != nil {
+		t.Fatal(err)
+	}
+	if frames := len(out) / 2; frames != 16000 {
+		t.Fatalf("got %d frames, want 16000", frames)
+	}
+	l := MeasureS16LE(out)
+	if math.Abs(l.RMS-0.5/math.Sqrt2) > 0.01 || math.Abs(l.Peak-0.5) > 0.01 {
+		t.Fatalf("levels %+v", l)
+	}
+}
+
+func TestConvertSourceIdentity(t *testing.T) {
+	src, _ := OpenSynth("silence?realtime=false", Format{})
+	got, err := ConvertSource(src, DefaultFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != Source(src) {
+		t.Fatal("identity conversion wrapped the source")
+	}
+}
+
+func TestConvertSourceUpmix(t *testing.T) {
+	src, _ := OpenSynth("sine?amp=0.25&duration=100ms&realtime=false", Format{SampleRate: 8000, Encoding: protocol.FormatMulaw})
+	conv, err := ConvertSource(src, Format{SampleRate: 8000, Channels: 2, Encoding: protocol.FormatS16LE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm, err := io.ReadAll(conv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm) != 800*4 {
+		t.Fatalf("got %d bytes", len(pcm))
+	}
+	for i := 0; i < len(pcm); i += 4 {
+		if pcm[i] != pcm[i+2] || pcm[i+1] != pcm[i+3] {
+			t.Fatalf("frame %d: channels differ", i/4)
+		}
+	}
+}
+
+func TestConvertSourceFlushes(t *testing.T) {
+	src, _ := OpenSynth("sine?duration=100ms&realtime=false", Format{SampleRate: 8000})
+	conv, err := ConvertSource(src, Format{SampleRate: 22050})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm, err := io.ReadAll(conv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm) != 2205*2 {
+		t.Fatalf("got %d frames, want 2205", len(pcm)/2)
+	}
+}
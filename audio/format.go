@@ -0,0 +1,56 @@
+package audio
+
+import (
+	"fmt"
+
+	"ion/protocol"
+)
+
+const (
+	DefaultSampleRate = 16000
+	DefaultChannels   = 1
+	DefaultEncoding   = protocol.FormatS16LE
+)
+
+// Format describes interleaved PCM.
+type Format struct {
+	SampleRate int
+	Channels   int
+	Encoding   protocol.SampleFormat
+}
+
+// FormatOf returns the stream format announced in a ready event.
+func FormatOf(ev protocol.ReadyEvent) Format {
+	return Format{SampleRate: ev.SampleRate, Channels: ev.Channels, Encoding: ev.Format}
+}
+
+func DefaultFormat() Format {
+	return Format{SampleRate: DefaultSampleRate, Channels: DefaultChannels, Encoding: DefaultEncoding}
+}
+
+// WithDefaults fills zero fields from DefaultFormat.
+func (f Format) WithDefaults() Format {
+	if f.SampleRate <= 0 {
+		f.SampleRate = DefaultSampleRate
+	}
+	if f.Channels <= 0 {
+		f.Channels = DefaultChannels
+	}
+	if f.Encoding == "" {
+		f.Encoding = DefaultEncoding
+	}
+	return f
+}
+
+func (f Format) BytesPerSample() int {
+	return f.Encoding.BytesPerSample()
+}
+
+// FrameSize is the size in bytes of one sample for every channel.
+func (f Format) FrameSize() int {
+	return f.BytesPerSample() * f.Channels
+}
+
+func (f Format) String() string {
+	return fmt.Sprintf("%s %dHz %dch", f.Encoding, f.SampleRate, f.Channels)
+}
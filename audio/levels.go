@@ -0,0 +1,61 @@
+package audio
+
+import (
+	"math"
+
+	"ion/protocol"
+)
+
+type Levels struct {
+	Samples int
+	Peak    float64
+	RMS     float64
+	Clipped int
+}
+
+// Samples at or beyond the largest positive s16 value count as clipped.
+const clipLevel = 32767.0 / 32768
+
+// Measure computes levels over interleaved samples, normalised to full
+// scale.
+func Measure(f protocol.SampleFormat, pcm []byte) (Levels, error) {
+	samples, err := protocol.DecodeSamples(nil, f, pcm)
+	if err != nil {
+		return Levels{}, err
+	}
+	return measure(samples), nil
+}
+
+// MeasureS16LE is Measure for s16le audio.
+func MeasureS16LE(pcm []byte) Levels {
+	l, _ := Measure(protocol.FormatS16LE, pcm)
+	return l
+}
+
+func measure(samples []float32) Levels {
+	var l Levels
+	var sum float64
+	for _, s := range samples {
+		v := float64(s)
+		a := math.Abs(v)
+		if a >= clipLevel {
+			l.Clipped++
+		}
+		if a > l.Peak {
+			l.Peak = a
+		}
+		sum += v * v
+	}
+	l.Samples = len(samples)
+	if l.Samples > 0 {
+		l.RMS = math.Sqrt(sum / float64(l.Samples))
+	}
+	return l
+}
+
+func DBFS(v float64) float64 {
+	if v <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(v)
+}
@@ -0,0 +1,196 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrBadMatrix = errors.New("audio: bad channel matrix")
+
+// Matrix mixes channels: output channel o is the sum over input channels i
+// of m[o][i] times input i. Channels are numbered from 0.
+type Matrix [][]float32
+
+func (m Matrix) Outputs() int {
+	return len(m)
+}
+
+func (m Matrix) Inputs() int {
+	if len(m) == 0 {
+		return 0
+	}
+	return len(m[0])
+}
+
+func (m Matrix) validate() error {
+	if len(m) == 0 || len(m[0]) == 0 {
+		return fmt.Errorf("%w: empty", ErrBadMatrix)
+	}
+	for _, row := range m {
+		if len(row) != len(m[0]) {
+			return fmt.Errorf("%w: ragged rows", ErrBadMatrix)
+		}
+	}
+	return nil
+}
+
+// IdentityMatrix passes n channels through unchanged.
+func IdentityMatrix(n int) Matrix {
+	m := newMatrix(n, n)
+	for i := range m {
+		m[i][i] = 1
+	}
+	return m
+}
+
+// DownmixMatrix averages in channels into one.
+func DownmixMatrix(in int) Matrix {
+	m := newMatrix(1, in)
+	for i := range m[0] {
+		m[0][i] = 1 / float32(in)
+	}
+	return m
+}
+
+// UpmixMatrix copies one channel to out channels.
+func UpmixMatrix(out int) Matrix {
+	m := newMatrix(out, 1)
+	for o := range m {
+		m[o][0] = 1
+	}
+	return m
+}
+
+// SelectMatrix keeps the listed input channels, in the given order.
+func SelectMatrix(in int, channels ...int) (Matrix, error) {
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("%w: no channels selected", ErrBadMatrix)
+	}
+	m := newMatrix(len(channels), in)
+	for o, ch := range channels {
+		if ch < 0 || ch >= in {
+			return nil, fmt.Errorf("%w: channel %d of %d", ErrBadMatrix, ch, in)
+		}
+		m[o][ch] = 1
+	}
+	return m, nil
+}
+
+// DefaultMatrix is the mix used when converting between channel counts
+// without an explicit matrix: many to one averages, one to many copies,
+// and otherwise channels are taken in order, wrapping around.
+func DefaultMatrix(in, out int) Matrix {
+	switch {
+	case in == out:
+		return IdentityMatrix(in)
+	case out == 1:
+		return DownmixMatrix(in)
+	case in == 1:
+		return UpmixMatrix(out)
+	}
+	m := newMatrix(out, in)
+	for o := range m {
+		m[o][o%in] = 1
+	}
+	return m
+}
+
+// Gain returns a copy of m with output channel o scaled by gains[o].
+// Missing gains leave the channel unchanged.
+func (m Matrix) Gain(gains ...float32) Matrix {
+	out := newMatrix(m.Outputs(), m.Inputs())
+	for o, row := range m {
+		g := float32(1)
+		if o < len(gains) {
+			g = gains[o]
+		}
+		for i, v := range row {
+			out[o][i] = v * g
+		}
+	}
+	return out
+}
+
+// GainDB converts decibels to a linear gain.
+func GainDB(db float64) float32 {
+	return float32(math.Pow(10, db/20))
+}
+
+// Apply mixes the interleaved frames in src and appends the result to dst.
+// It holds no state, so chunks may be processed independently as long as
+// they contain whole frames.
+func (m Matrix) Apply(dst, src []float32) []float32 {
+	in, out := m.Inputs(), m.Outputs()
+	frames := len(src) / in
+	for f := 0; f < frames; f++ {
+		frame := src[f*in : (f+1)*in]
+		for o := 0; o < out; o++ {
+			var acc float32
+			for i, v := range m[o] {
+				if v != 0 {
+					acc += v * frame[i]
+				}
+			}
+			dst = append(dst, acc)
+		}
+	}
+	return dst
+}
+
+func newMatrix(out, in int) Matrix {
+	m := make(Matrix, out)
+	cells := make([]float32, out*in)
+	for o := range m {
+		m[o] = cells[o*in : (o+1)*in : (o+1)*in]
+	}
+	return m
+}
+
+// ParseMatrix builds a matrix for in input channels from a map such as
+// "2" (keep mic 2), "1,3" (two outputs), "mono" (average all), or
+// "0.5*1+0.5*2,-6dB*3". Outputs are separated by commas; each is a sum of
+// channel terms with an optional linear or dB gain. Channels in the spec
+// are numbered from 1.
+func ParseMatrix(spec string, in int) (Matrix, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "mono" {
+		return DownmixMatrix(in), nil
+	}
+	outputs := strings.Split(spec, ",")
+	m := newMatrix(len(outputs), in)
+	for o, expr := range outputs {
+		terms := strings.Split(expr, "+")
+		for _, term := range terms {
+			gain := float32(1)
+			term = strings.TrimSpace(term)
+			if g, ch, ok := strings.Cut(term, "*"); ok {
+				var err error
+				if gain, err = parseGain(strings.TrimSpace(g)); err != nil {
+					return nil, fmt.Errorf("%w: %q: %v", ErrBadMatrix, spec, err)
+				}
+				term = strings.TrimSpace(ch)
+			}
+			ch, err := strconv.Atoi(term)
+			if err != nil || ch < 1 || ch > in {
+				return nil, fmt.Errorf("%w: %q: no channel %q of %d", ErrBadMatrix, spec, term, in)
+			}
+			m[o][ch-1] += gain
+		}
+	}
+	return m, nil
+}
+
+func parseGain(s string) (float32, error) {
+	if db, ok := strings.CutSuffix(strings.ToLower(s), "db"); ok {
+		v, err := strconv.ParseFloat(db, 64)
+		if err != nil {
+			return 0, err
+		}
+		return GainDB(v), nil
+	}
+	v, err := strconv.ParseFloat(s, 32)
+	return float32(v), err
+}
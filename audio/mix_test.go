@@ -0,0 +1,116 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"ion/protocol"
+)
+
+func TestParseMatrix(t *testing.T) {
+	cases := []struct {
+		spec string
+		in   int
+		want Matrix
+	}{
+		{"2", 4, Matrix{{0, 1, 0, 0}}},
+		{"1,3", 3, Matrix{{1, 0, 0}, {0, 0, 1}}},
+		{"mono", 2, Matrix{{0.5, 0.5}}},
+		{"0.5*1 + 0.25*2", 2, Matrix{{0.5, 0.25}}},
+		{"-6dB*2", 2, Matrix{{0, GainDB(-6)}}},
+	}
+	for _, tc := range cases {
+		got, err := ParseMatrix(tc.spec, tc.in)
+		if err != nil {
+			t.Errorf("%q: %v", tc.spec, err)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.spec, got, tc.want)
+			continue
+		}
+		for o := range got {
+			for i := range got[o] {
+				if math.Abs(float64(got[o][i]-tc.want[o][i])) > 1e-6 {
+					t.Errorf("%q: got %v, want %v", tc.spec, got, tc.want)
+				}
+			}
+		}
+	}
+	for _, spec := range []string{"", "0", "5", "x", "a*1", "1,,2"} {
+		if _, err := ParseMatrix(spec, 4); !errors.Is(err, ErrBadMatrix) {
+			t.Errorf("%q: got %v, want ErrBadMatrix", spec, err)
+		}
+	}
+}
+
+func TestMatrixApply(t *testing.T) {
+	m, err := SelectMatrix(4, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := []float32{0, 1, 2, 3, 10, 11, 12, 13}
+	got := m.Gain(1, 0.5).Apply(nil, src)
+	want := []float32{3, 0.5, 13, 5.5}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if _, err := SelectMatrix(2, 2); !errors.Is(err, ErrBadMatrix) {
+		t.Errorf("out of range channel: got %v", err)
+	}
+}
+
+func TestMixSource(t *testing.T) {
+	// Six channels where only channel 2 (index 1) carries signal.
+	f := Format{SampleRate: 16000, Channels: 6, Encoding: protocol.FormatS16LE}
+	samples := make([]float32, 6*100)
+	for i := 0; i < 100; i++ {
+		samples[i*6+1] = 0.5
+	}
+	pcm, err := protocol.EncodeSamples(nil, f.Encoding, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := ParseMatrix("2", 6)
+	src, err := MixSource(&readerSource{Reader: bytes.NewReader(pcm), format: f}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := src.Format(); got.Channels != 1 || got.SampleRate != 16000 {
+		t.Fatalf("format: %v", got)
+	}
+	out, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := protocol.DecodeSamples(nil, f.Encoding, out)
+	if len(got) != 100 {
+		t.Fatalf("got %d samples, want 100", len(got))
+	}
+	for _, v := range got {
+		if math.Abs(float64(v-0.5)) > 1e-3 {
+			t.Fatalf("sample %v, want 0.5", v)
+		}
+	}
+
+	bad := Matrix{{1, 0}}
+	if _, err := MixSource(&readerSource{Reader: bytes.NewReader(pcm), format: f}, bad); !errors.Is(err, ErrBadMatrix) {
+		t.Errorf("mismatched matrix: got %v", err)
+	}
+}
+
+type readerSource struct {
+	io.Reader
+	format Format
+}
+
+func (s *readerSource) Format() Format { return s.format }
+func (s *readerSource) Close() error   { return nil }
@@ -0,0 +1,236 @@
+// Package resample converts interleaved float PCM between sample rates with
+// a polyphase windowed-sinc filter.
+//
+// The ratio out/in is reduced to L/M. Output sample k sits at input time
+// k*M/L; it is the sum of the neighbouring input samples weighted by a
+// Kaiser-windowed sinc whose cutoff is the lower of the two Nyquist rates,
+// so downsampling is anti-aliased. The weights for each of the L possible
+// fractional positions are precomputed (or interpolated from a capped
+// table when L is very large).
+package resample
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrInvalidRate = errors.New("resample: invalid rate or channel count")
+
+// Quality trades filter length (CPU and latency) for stopband attenuation
+// and passband width.
+type Quality struct {
+	// Taps is the filter length in input samples when not downsampling;
+	// it grows by the downsampling factor to keep the transition band.
+	Taps int
+	// Rolloff is the cutoff as a fraction of the lower Nyquist rate.
+	Rolloff float64
+	// Beta is the Kaiser window parameter; higher means more attenuation
+	// and a wider transition band.
+	Beta float64
+}
+
+var (
+	Fast   = Quality{Taps: 16, Rolloff: 0.85, Beta: 6}
+	Medium = Quality{Taps: 32, Rolloff: 0.90, Beta: 8.5}
+	High   = Quality{Taps: 64, Rolloff: 0.94, Beta: 11}
+)
+
+// maxPhases caps the coefficient table. Ratios that need more fractional
+// positions interpolate between neighbouring rows.
+const maxPhases = 4096
+
+// MaxDownsample is the largest in/out ratio New accepts. The filter widens
+// with the ratio, so it bounds the work per output sample.
+const MaxDownsample = 64
+
+// maxCoefs bounds the table size when wide filters meet many phases; fewer
+// rows are kept and interpolated instead.
+const maxCoefs = 1 << 21
+
+type Resampler struct {
+	inRate, outRate int
+	channels        int
+	l, m            int64 // out/in reduced
+	half            int   // filter half-width in input frames
+	phases          int   // table rows minus one
+	coef            []float32
+
+	buf []float32 // interleaved input history
+	t   int64     // next output time in 1/l input frames, relative to buf[0]
+	in  int64     // input frames consumed
+	out int64     // output frames produced
+}
+
+func New(inRate, outRate, channels int, q Quality) (*Resampler, error) {
+	if inRate <= 0 || outRate <= 0 || channels <= 0 {
+		return nil, fmt.Errorf("%w: %d -> %d Hz, %d channels", ErrInvalidRate, inRate, outRate, channels)
+	}
+	if inRate > outRate*MaxDownsample {
+		return nil, fmt.Errorf("%w: %d -> %d Hz exceeds %dx downsampling", ErrInvalidRate, inRate, outRate, MaxDownsample)
+	}
+	if q.Taps < 2 {
+		q.Taps = 2
+	}
+	q.Taps = min(q.Taps, 1024) // keeps at least a few table rows under maxCoefs
+	if q.Rolloff <= 0 || q.Rolloff > 1 {
+		q.Rolloff = 1
+	}
+
+	g := gcd(int64(inRate), int64(outRate))
+	r := &Resampler{
+		inRate:   inRate,
+		outRate:  outRate,
+		channels: channels,
+		l:        int64(outRate) / g,
+		m:        int64(inRate) / g,
+	}
+
+	// scale < 1 when downsampling: the sinc is stretched to the output
+	// Nyquist rate and needs proportionally more taps.
+	scale := math.Min(1, float64(outRate)/float64(inRate)) * q.Rolloff
+	r.half = int(math.Ceil(float64(q.Taps) / 2 / math.Min(1, float64(outRate)/float64(inRate))))
+
+	width := 2 * r.half
+	r.phases = int(min(r.l, maxPhases, int64(maxCoefs/width-1)))
+	r.coef = make([]float32, (r.phases+1)*width)
+	i0beta := besselI0(q.Beta)
+	for p := 0; p <= r.phases; p++ {
+		frac := float64(p) / float64(r.phases)
+		row := r.coef[p*width : (p+1)*width]
+		for j := range row {
+			// Tap j multiplies input frame i-half+1+j for an output at
+			// input time i+frac.
+			x := frac + float64(r.half-1-j)
+			row[j] = float32(kernel(x, scale, float64(r.half), q.Beta, i0beta))
+		}
+	}
+
+	r.Reset()
+	return r, nil
+}
+
+func kernel(x, scale, half, beta, i0beta float64) float64 {
+	if math.Abs(x) >= half {
+		return 0
+	}
+	w := besselI0(beta*math.Sqrt(1-(x/half)*(x/half))) / i0beta
+	return scale * sinc(scale*x) * w
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// besselI0 is the zeroth-order modified Bessel function of the first kind.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 64; k++ {
+		term *= (x / 2) / float64(k)
+		sum += term * term
+		if term*term < sum*1e-17 {
+			break
+		}
+	}
+	return sum
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Reset discards buffered input so the resampler can start a new stream.
+func (r *Resampler) Reset() {
+	// Start with half-1 frames of silence so the first output, at input
+	// time 0, has a full window of history.
+	r.buf = append(r.buf[:0], make([]float32, (r.half-1)*r.channels)...)
+	r.t = int64(r.half-1) * r.l
+	r.in, r.out = 0, 0
+}
+
+// Latency is the number of input frames that must arrive after a given
+// instant before the output for that instant can be produced.
+func (r *Resampler) Latency() int {
+	return r.half
+}
+
+func (r *Resampler) Channels() int { return r.channels }
+func (r *Resampler) InRate() int   { return r.inRate }
+func (r *Resampler) OutRate() int  { return r.outRate }
+
+// Process consumes interleaved input frames and appends the output frames
+// that can be computed so far to dst. A trailing partial frame in src is
+// ignored.
+func (r *Resampler) Process(dst, src []float32) []float32 {
+	frames := len(src) / r.channels
+	r.buf = append(r.buf, src[:frames*r.channels]...)
+	r.in += int64(frames)
+	return r.run(dst, -1)
+}
+
+// Flush appends the remaining output for the input seen so far, so the
+// total output length is in*out/in rounded up, and resets the resampler.
+func (r *Resampler) Flush(dst []float32) []float32 {
+	r.buf = append(r.buf, make([]float32, r.half*r.channels)...)
+	want := (r.in*r.l + r.m - 1) / r.m
+	dst = r.run(dst, want)
+	r.Reset()
+	return dst
+}
+
+// run produces output frames while the input window is available, up to a
+// total of limit frames if limit >= 0.
+func (r *Resampler) run(dst []float32, limit int64) []float32 {
+	ch := r.channels
+	width := 2 * r.half
+	avail := int64(len(r.buf) / ch)
+	for limit < 0 || r.out < limit {
+		i := r.t / r.l
+		if i+int64(r.half) >= avail {
+			break
+		}
+		p := r.t % r.l
+		start := int(i-int64(r.half)+1) * ch
+
+		// Locate the table row, interpolating if the table is coarser
+		// than the ratio needs.
+		pos := p * int64(r.phases)
+		row := int(pos / r.l)
+		w := float32(pos%r.l) / float32(r.l)
+		c0 := r.coef[row*width : (row+1)*width]
+		c1 := r.coef[(row+1)*width : (row+2)*width]
+
+		for c := 0; c < ch; c++ {
+			var acc float32
+			k := start + c
+			if w == 0 {
+				for j := 0; j < width; j++ {
+					acc += r.buf[k] * c0[j]
+					k += ch
+				}
+			} else {
+				for j := 0; j < width; j++ {
+					acc += r.buf[k] * (c0[j] + (c1[j]-c0[j])*w)
+					k += ch
+				}
+			}
+			dst = append(dst, acc)
+		}
+		r.t += r.m
+		r.out++
+	}
+
+	// Drop input that no future output window reaches.
+	if keep := r.t/r.l - int64(r.half) + 1; keep > 0 {
+		n := int(keep) * ch
+		r.buf = append(r.buf[:0], r.buf[n:]...)
+		r.t -= keep * r.l
+	}
+	return dst
+}
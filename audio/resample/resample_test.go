@@ -0,0 +1,164 @@
+package resample
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func tone(rate, frames, channels int, freq, amp float64) []float32 {
+	out := make([]float32, frames*channels)
+	for i := 0; i < frames; i++ {
+		v := float32(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+		for c := 0; c < channels; c++ {
+			out[i*channels+c] = v
+		}
+	}
+	return out
+}
+
+// snr compares got (channel c) against an ideal tone, ignoring the edges
+// where the filter sees the implicit silence around the signal.
+func snr(got []float32, rate, channels, c int, freq, amp float64) float64 {
+	frames := len(got) / channels
+	skip := frames / 10
+	var sig, noise float64
+	for i := skip; i < frames-skip; i++ {
+		want := amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate))
+		d := float64(got[i*channels+c]) - want
+		sig += want * want
+		noise += d * d
+	}
+	return 10 * math.Log10(sig/noise)
+}
+
+func rms(x []float32, skipFrac int) float64 {
+	skip := len(x) / skipFrac
+	var sum float64
+	for _, v := range x[skip : len(x)-skip] {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(x)-2*skip))
+}
+
+func run(t *testing.T, in, out, channels int, q Quality, src []float32) []float32 {
+	t.Helper()
+	r, err := New(in, out, channels, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := r.Process(nil, src)
+	return r.Flush(dst)
+}
+
+func TestSNR(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		in, out int
+		q       Quality
+		minSNR  float64
+	}{
+		{"48k-16k high", 48000, 16000, High, 110},
+		{"48k-16k medium", 48000, 16000, Medium, 85},
+		{"48k-16k fast", 48000, 16000, Fast, 70},
+		{"16k-48k high", 16000, 48000, High, 100},
+		{"44.1k-16k high", 44100, 16000, High, 100},
+		{"22.05k-16k high", 22050, 16000, High, 100},
+		{"8k-11025 medium", 8000, 11025, Medium, 80},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := tone(tc.in, tc.in/2, 1, 1000, 0.5)
+			got := run(t, tc.in, tc.out, 1, tc.q, src)
+			if want := (len(src)*tc.out + tc.in - 1) / tc.in; len(got) != want {
+				t.Fatalf("got %d frames, want %d", len(got), want)
+			}
+			if s := snr(got, tc.out, 1, 0, 1000, 0.5); s < tc.minSNR {
+				t.Fatalf("SNR %.1f dB, want >= %.0f", s, tc.minSNR)
+			}
+		})
+	}
+}
+
+func TestAliasing(t *testing.T) {
+	// 12 kHz is above the 8 kHz Nyquist rate of the output; without
+	// filtering it would fold down to 4 kHz at full level.
+	for _, tc := range []struct {
+		q     Quality
+		maxDB float64
+	}{{High, -120}, {Medium, -85}, {Fast, -60}} {
+		src := tone(48000, 24000, 1, 12000, 0.5)
+		got := run(t, 48000, 16000, 1, tc.q, src)
+		if db := 20 * math.Log10(rms(got, 10)/(0.5/math.Sqrt2)); db > tc.maxDB {
+			t.Errorf("taps %d: alias at %.1f dB, want <= %.0f", tc.q.Taps, db, tc.maxDB)
+		}
+	}
+}
+
+func TestStreamingMatchesOneShot(t *testing.T) {
+	const channels = 2
+	src := tone(44100, 4410, channels, 440, 0.7)
+	for i := 1; i < len(src); i += 2 {
+		src[i] *= -0.5 // make the channels differ
+	}
+	want := run(t, 44100, 48000, channels, Medium, src)
+
+	r, _ := New(44100, 48000, channels, Medium)
+	var got []float32
+	for i := 0; i < len(src); {
+		n := min(len(src)-i, (i%7+1)*channels*13)
+		got = r.Process(got, src[i:i+n])
+		i += n
+	}
+	got = r.Flush(got)
+
+	if len(got) != len(want) {
+		t.Fatalf("streamed %d samples, one-shot %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d: %v != %v", i, got[i], want[i])
+		}
+	}
+	if s := snr(got, 48000, channels, 1, 440, -0.35); s < 70 {
+		t.Fatalf("channel 1 SNR %.1f dB", s)
+	}
+}
+
+func TestLargeRatio(t *testing.T) {
+	// 44101/48000 needs 48000 phases, more than the table holds.
+	src := tone(44101, 22050, 1, 1000, 0.5)
+	got := run(t, 44101, 48000, 1, High, src)
+	if s := snr(got, 48000, 1, 0, 1000, 0.5); s < 110 {
+		t.Fatalf("SNR %.1f dB", s)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	if _, err := New(0, 16000, 1, High); err == nil {
+		t.Fatal("zero rate accepted")
+	}
+	if _, err := New(4800007, 16000, 1, High); !errors.Is(err, ErrInvalidRate) {
+		t.Fatalf("300x downsampling: got %v", err)
+	}
+}
+
+func TestTableBounded(t *testing.T) {
+	// The widest filter allowed, with a ratio that needs every phase.
+	r, err := New(16000*MaxDownsample-1, 16000, 1, Quality{Taps: 1 << 20, Rolloff: 0.9, Beta: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.coef) > maxCoefs {
+		t.Fatalf("table has %d coefficients, cap is %d", len(r.coef), maxCoefs)
+	}
+}
+
+func BenchmarkHigh48to16(b *testing.B) {
+	r, _ := New(48000, 16000, 1, High)
+	src := tone(48000, 960, 1, 1000, 0.5)
+	var dst []float32
+	b.SetBytes(int64(len(src) * 4))
+	for i := 0; i < b.N; i++ {
+		dst = r.Process(dst[:0], src)
+	}
+}
@@ -0,0 +1,191 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownSink = errors.New("audio: unknown sink")
+
+// Sink consumes interleaved PCM in Format. Close flushes buffered audio;
+// for players that means waiting for playback to finish, for a few seconds
+// at most.
+type Sink interface {
+	io.Writer
+	Format() Format
+	Close() error
+}
+
+// OpenSink opens a playback sink from a URI:
+//
+//	pacat[:DEVICE]          PulseAudio/PipeWire via pacat (the default)
+//	paplay[:DEVICE]         PulseAudio/PipeWire via paplay
+//	aplay[:DEVICE]          ALSA via aplay
+//	pw-play[:TARGET]        PipeWire via pw-play
+//	cmd:SHELL COMMAND       raw PCM to a command's stdin
+//	wav:PATH                a WAV file in f
+//	null                    discards audio
+func OpenSink(uri string, f Format) (Sink, error) {
+	f = f.WithDefaults()
+	if f.FrameSize() == 0 {
+		return nil, fmt.Errorf("audio: unsupported encoding %q", f.Encoding)
+	}
+	scheme, arg, _ := strings.Cut(uri, ":")
+	switch scheme {
+	case "", "default", "pacat":
+		return startPlayer(f, "pacat", append([]string{"--playback"}, pulseArgs(arg, f)...)...)
+	case "paplay":
+		return startPlayer(f, "paplay", pulseArgs(arg, f)...)
+	case "aplay":
+		return openAplay(arg, f)
+	case "pw-play":
+		return openPWPlay(arg, f)
+	case "cmd":
+		if strings.TrimSpace(arg) == "" {
+			return nil, fmt.Errorf("%w: cmd: needs a command", ErrUnknownSink)
+		}
+		return startPlayer(f, "sh", "-c", arg)
+	case "wav":
+		return CreateWAVSink(arg, f)
+	case "null":
+		return NullSink(f), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownSink, uri)
+}
+
+// playerDrain is how long Close lets a player finish the audio it has
+// buffered after stdin closes, before killing it.
+const playerDrain = 5 * time.Second
+
+// commandSink writes raw PCM to a child process's stdin. Writes do not hold
+// mu, so Close can close stdin under a write stuck on a player that stopped
+// reading, which ends that write with an error. A player that does not exit
+// within drain of stdin closing is killed.
+type commandSink struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	format Format
+	drain  time.Duration
+
+	mu     sync.Mutex
+	closed bool
+
+	closeOnce sync.Once
+	err       error
+}
+
+func startPlayer(f Format, name string, args ...string) (*commandSink, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandSink{cmd: cmd, stdin: stdin, format: f, drain: playerDrain}, nil
+}
+
+func (s *commandSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return 0, os.ErrClosed
+	}
+	return s.stdin.Write(p)
+}
+
+func (s *commandSink) Format() Format {
+	return s.format
+}
+
+func (s *commandSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.closeOnce.Do(func() {
+		_ = s.stdin.Close()
+		done := make(chan error, 1)
+		go func() { done <- s.cmd.Wait() }()
+		t := time.NewTimer(s.drain)
+		defer t.Stop()
+		select {
+		case s.err = <-done:
+		case <-t.C:
+			_ = s.cmd.Process.Kill()
+			<-done
+			s.err = fmt.Errorf("audio: %s did not exit within %v of end of input", s.cmd.Path, s.drain)
+		}
+	})
+	return s.err
+}
+
+func pulseArgs(device string, f Format) []string {
+	args := []string{
+		"--raw",
+		"--format", pulseFormat(f.Encoding),
+		"--rate", strconv.Itoa(f.SampleRate),
+		"--channels", strconv.Itoa(f.Channels),
+	}
+	if device != "" {
+		args = append(args, "--device", device)
+	}
+	return args
+}
+
+func openAplay(device string, f Format) (Sink, error) {
+	enc, ok := alsaFormats[f.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("audio: aplay cannot play %q", f.Encoding)
+	}
+	args := []string{
+		"-q", "-t", "raw",
+		"-f", enc,
+		"-r", strconv.Itoa(f.SampleRate),
+		"-c", strconv.Itoa(f.Channels),
+	}
+	if device != "" {
+		args = append(args, "-D", device)
+	}
+	return startPlayer(f, "aplay", args...)
+}
+
+func openPWPlay(target string, f Format) (Sink, error) {
+	enc, ok := pwFormats[f.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("audio: pw-play cannot play %q", f.Encoding)
+	}
+	args := []string{
+		"--raw",
+		"--format", enc,
+		"--rate", strconv.Itoa(f.SampleRate),
+		"--channels", strconv.Itoa(f.Channels),
+	}
+	if target != "" {
+		args = append(args, "--target", target)
+	}
+	args = append(args, "-")
+	return startPlayer(f, "pw-play", args...)
+}
+
+type nullSink struct {
+	format Format
+}
+
+func NullSink(f Format) Sink {
+	return nullSink{format: f.WithDefaults()}
+}
+
+func (s nullSink) Write(p []byte) (int, error) { return len(p), nil }
+func (s nullSink) Format() Format              { return s.format }
+func (s nullSink) Close() error                { return nil }
@@ -0,0 +1,115 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWAVSinkRoundtrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	format := Format{SampleRate: 24000, Channels: 1, Encoding: "s24le"}
+	sink, err := OpenSink("wav:"+path, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	for i := 0; i < len(pcm); i += 3 {
+		if _, err := sink.Write(pcm[i : i+3]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := OpenWAVSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if src.Format() != format {
+		t.Fatalf("format = %v", src.Format())
+	}
+	got, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, pcm) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestCommandSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raw")
+	sink, err := OpenSink("cmd:cat > "+path, Format{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write([]byte{1, 2})
+	sink.Write([]byte{3, 4})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{1, 2, 3, 4}) {
+		t.Fatalf("got %v", got)
+	}
+	if _, err := sink.Write([]byte{5}); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("write after close: %v", err)
+	}
+}
+
+func TestCommandSinkCloseUnblocksWrite(t *testing.T) {
+	// The player never reads, so a write larger than the pipe buffer blocks.
+	sink, err := OpenSink("cmd:exec sleep 60", Format{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.(*commandSink).drain = 10 * time.Millisecond
+	wrote := make(chan error)
+	go func() {
+		_, err := sink.Write(make([]byte, 1<<20))
+		wrote <- err
+	}()
+	closed := make(chan struct{})
+	go func() {
+		sink.Close()
+		close(closed)
+	}()
+	select {
+	case err := <-wrote:
+		if err == nil {
+			t.Error("write to a closed sink succeeded")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not interrupt a blocked write")
+	}
+	<-closed
+}
+
+func TestCommandSinkCloseKillsPlayer(t *testing.T) {
+	// The player ignores the end of its input.
+	sink, err := OpenSink("cmd:exec sleep 60", Format{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.(*commandSink).drain = 10 * time.Millisecond
+	closed := make(chan error)
+	go func() { closed <- sink.Close() }()
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Error("Close reported success for a killed player")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close waited for a player that ignores end of input")
+	}
+}
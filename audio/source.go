@@ -0,0 +1,51 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrUnknownSource = errors.New("audio: unknown source")
+
+// Source produces interleaved PCM in Format. Read blocks like a capture
+// device; io.EOF marks the end of finite sources.
+type Source interface {
+	io.Reader
+	Format() Format
+	Close() error
+}
+
+// OpenSource opens a capture source from a URI:
+//
+//	parec[:DEVICE]          PulseAudio/PipeWire via parec (the default)
+//	arecord[:DEVICE]        ALSA via arecord
+//	pw-record[:TARGET]      PipeWire via pw-record
+//	cmd:SHELL COMMAND       raw PCM from a command's stdout, assumed to be f
+//	wav:PATH                a WAV file; its own format is used
+//	synth:KIND[?OPTIONS]    generated audio, see OpenSynth
+//
+// f is the requested format; zero fields take the defaults.
+func OpenSource(uri string, f Format) (Source, error) {
+	f = f.WithDefaults()
+	scheme, arg, _ := strings.Cut(uri, ":")
+	switch scheme {
+	case "", "default", "parec":
+		return openParec(arg, f)
+	case "arecord":
+		return openArecord(arg, f)
+	case "pw-record":
+		return openPWRecord(arg, f)
+	case "cmd":
+		if strings.TrimSpace(arg) == "" {
+			return nil, fmt.Errorf("%w: cmd: needs a command", ErrUnknownSource)
+		}
+		return startCommand(f, "sh", "-c", arg)
+	case "wav":
+		return OpenWAVSource(arg)
+	case "synth":
+		return OpenSynth(arg, f)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownSource, uri)
+}
@@ -0,0 +1,91 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSynthDuration(t *testing.T) {
+	src, err := OpenSource("synth:sine?freq=1000&amp=1&duration=100ms&realtime=false", Format{SampleRate: 8000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	pcm, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm) != 800*2 {
+		t.Fatalf("got %d bytes, want %d", len(pcm), 800*2)
+	}
+	if l := MeasureS16LE(pcm); l.Peak < 0.99 || l.RMS < 0.69 || l.RMS > 0.72 {
+		t.Fatalf("unexpected levels %+v", l)
+	}
+}
+
+func TestWAVSource(t *testing.T) {
+	samples := []int16{0, 1000, -1000, 32767, -32768, 5}
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, samples)
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(4+8+16+8+2+8+data.Len()))
+	file.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(2), uint32(22050), uint32(22050 * 4), uint16(4), uint16(16)} {
+		binary.Write(&file, binary.LittleEndian, v)
+	}
+	file.WriteString("LIST")
+	binary.Write(&file, binary.LittleEndian, uint32(1))
+	file.Write([]byte{0, 0}) // odd chunk plus pad byte
+	file.WriteString("data")
+	binary.Write(&file, binary.LittleEndian, uint32(data.Len()))
+	file.Write(data.Bytes())
+
+	path := filepath.Join(t.TempDir(), "in.wav")
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := OpenSource("wav:"+path, Format{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if f := src.Format(); f != (Format{SampleRate: 22050, Channels: 2, Encoding: "s16le"}) {
+		t.Fatalf("format = %v", f)
+	}
+	pcm, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pcm, data.Bytes()) {
+		t.Fatalf("data mismatch")
+	}
+}
+
+func TestCommandSource(t *testing.T) {
+	src, err := OpenSource(`cmd:printf '\001\002\003\004'`, Format{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	pcm, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pcm, []byte{1, 2, 3, 4}) {
+		t.Fatalf("got %v", pcm)
+	}
+}
+
+func TestOpenSourceUnknown(t *testing.T) {
+	if _, err := OpenSource("tape:/dev/st0", Format{}); !errors.Is(err, ErrUnknownSource) {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ion/protocol"
+)
+
+// Synth generates a test signal. It is paced like a capture device unless
+// Realtime is false.
+type Synth struct {
+	Kind      string // sine, silence or noise
+	Frequency float64
+	Amplitude float64 // 0..1 of full scale
+	Duration  time.Duration
+	Realtime  bool
+
+	format  Format
+	frames  int64
+	limit   int64
+	phase   float64
+	rng     *rand.Rand
+	buf     []float32
+	started time.Time
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// OpenSynth parses "KIND?freq=440&amp=0.5&duration=2s&realtime=false".
+func OpenSynth(spec string, f Format) (*Synth, error) {
+	f = f.WithDefaults()
+	if f.FrameSize() == 0 {
+		return nil, fmt.Errorf("audio: unsupported encoding %q", f.Encoding)
+	}
+	kind, rawQuery, _ := strings.Cut(spec, "?")
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("audio: synth options: %w", err)
+	}
+	s := &Synth{Kind: kind, Frequency: 440, Amplitude: 0.5, Realtime: true}
+	if s.Kind == "" {
+		s.Kind = "sine"
+	}
+	switch s.Kind {
+	case "sine", "silence", "noise":
+	default:
+		return nil, fmt.Errorf("%w: synth kind %q", ErrUnknownSource, s.Kind)
+	}
+	if v := q.Get("freq"); v != "" {
+		if s.Frequency, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("audio: synth freq: %w", err)
+		}
+	}
+	if v := q.Get("amp"); v != "" {
+		if s.Amplitude, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("audio: synth amp: %w", err)
+		}
+	}
+	if v := q.Get("duration"); v != "" {
+		if s.Duration, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("audio: synth duration: %w", err)
+		}
+	}
+	if v := q.Get("realtime"); v != "" {
+		if s.Realtime, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("audio: synth realtime: %w", err)
+		}
+	}
+	s.init(f)
+	return s, nil
+}
+
+func (s *Synth) init(f Format) {
+	s.format = f
+	s.limit = int64(s.Duration.Seconds() * float64(f.SampleRate))
+	s.rng = rand.New(rand.NewSource(1))
+}
+
+func (s *Synth) Format() Format {
+	return s.format
+}
+
+func (s *Synth) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return 0, io.EOF
+	}
+
+	frameSize := s.format.FrameSize()
+	n := len(p) / frameSize
+	if s.limit > 0 {
+		if left := s.limit - s.frames; int64(n) > left {
+			n = int(left)
+		}
+		if n == 0 {
+			return 0, io.EOF
+		}
+	}
+	if n == 0 {
+		return 0, io.ErrShortBuffer
+	}
+
+	if s.Realtime {
+		if s.started.IsZero() {
+			s.started = time.Now()
+		}
+		due := s.started.Add(time.Duration(float64(s.frames+int64(n)) / float64(s.format.SampleRate) * float64(time.Second)))
+		time.Sleep(time.Until(due))
+	}
+
+	step := 2 * math.Pi * s.Frequency / float64(s.format.SampleRate)
+	s.buf = s.buf[:0]
+	for i := 0; i < n; i++ {
+		var v float64
+		switch s.Kind {
+		case "sine":
+			v = s.Amplitude * math.Sin(s.phase)
+			s.phase += step
+			if s.phase > 2*math.Pi {
+				s.phase -= 2 * math.Pi
+			}
+		case "noise":
+			v = s.Amplitude * (2*s.rng.Float64() - 1)
+		}
+		for ch := 0; ch < s.format.Channels; ch++ {
+			s.buf = append(s.buf, float32(v))
+		}
+	}
+	s.frames += int64(n)
+	out, err := protocol.EncodeSamples(p[:0], s.format.Encoding, s.buf)
+	return len(out), err
+}
+
+func (s *Synth) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,93 @@
+package vad
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Spectral flatness is measured over the band where speech carries most
+// of its energy, so an empty upper band at high sample rates does not make
+// broadband noise look tonal.
+const (
+	bandLow  = 100
+	bandHigh = 4000
+)
+
+type spectrum struct {
+	window   []float64
+	re, im   []float64
+	cos, sin []float64
+	lo, hi   int
+}
+
+func newSpectrum(frameLen, rate int) *spectrum {
+	n := 1 << bits.Len(uint(frameLen-1))
+	s := &spectrum{
+		window: make([]float64, frameLen),
+		re:     make([]float64, n),
+		im:     make([]float64, n),
+		cos:    make([]float64, n/2),
+		sin:    make([]float64, n/2),
+	}
+	for i := range s.window {
+		s.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameLen-1))
+	}
+	for i := range s.cos {
+		s.cos[i] = math.Cos(2 * math.Pi * float64(i) / float64(n))
+		s.sin[i] = -math.Sin(2 * math.Pi * float64(i) / float64(n))
+	}
+	s.lo = max(1, bandLow*n/rate)
+	s.hi = min(n/2, bandHigh*n/rate)
+	if s.hi <= s.lo {
+		s.lo, s.hi = 1, n/2
+	}
+	return s
+}
+
+// flatness is the ratio of the geometric to the arithmetic mean of the
+// power spectrum of frame with mean removed.
+func (s *spectrum) flatness(frame []float32, mean float64) float64 {
+	for i := range s.re {
+		s.re[i], s.im[i] = 0, 0
+	}
+	for i, v := range frame {
+		s.re[i] = (float64(v) - mean) * s.window[i]
+	}
+	s.fft()
+
+	var logSum, sum float64
+	for k := s.lo; k < s.hi; k++ {
+		p := s.re[k]*s.re[k] + s.im[k]*s.im[k] + 1e-20
+		logSum += math.Log(p)
+		sum += p
+	}
+	n := float64(s.hi - s.lo)
+	return math.Exp(logSum/n) / (sum / n)
+}
+
+// fft is an in-place iterative radix-2 transform of re, im.
+func (s *spectrum) fft() {
+	n := len(s.re)
+	shift := bits.UintSize - bits.Len(uint(n-1))
+	for i := 0; i < n; i++ {
+		j := int(bits.Reverse(uint(i)) >> shift)
+		if j > i {
+			s.re[i], s.re[j] = s.re[j], s.re[i]
+			s.im[i], s.im[j] = s.im[j], s.im[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		half, step := size/2, n/size
+		for start := 0; start < n; start += size {
+			for k := 0; k < half; k++ {
+				wr, wi := s.cos[k*step], s.sin[k*step]
+				a, b := start+k, start+k+half
+				tr := s.re[b]*wr - s.im[b]*wi
+				ti := s.re[b]*wi + s.im[b]*wr
+				s.re[b], s.im[b] = s.re[a]-tr, s.im[a]-ti
+				s.re[a] += tr
+				s.im[a] += ti
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package vad
+
+import (
+	"ion/audio"
+	"ion/protocol"
+)
+
+// Stream runs a Detector on interleaved PCM, averaging channels to mono.
+type Stream struct {
+	*Detector
+	format  audio.Format
+	mix     audio.Matrix
+	partial []byte
+	samples []float32
+	mono    []float32
+}
+
+func NewStream(f audio.Format, cfg Config) (*Stream, error) {
+	f = f.WithDefaults()
+	d, err := New(f.SampleRate, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stream{Detector: d, format: f}
+	if f.Channels > 1 {
+		s.mix = audio.DownmixMatrix(f.Channels)
+	}
+	return s, nil
+}
+
+func (s *Stream) Format() audio.Format { return s.format }
+
+// Write analyses pcm and appends any activity changes to dst. Bytes of an
+// incomplete trailing frame are held until the next call.
+func (s *Stream) Write(dst []Event, pcm []byte) ([]Event, error) {
+	frameSize := s.format.FrameSize()
+	if len(s.partial) > 0 {
+		s.partial = append(s.partial, pcm...)
+		pcm, s.partial = s.partial, nil
+	}
+	whole := len(pcm) / frameSize * frameSize
+	if whole < len(pcm) {
+		s.partial = append(s.partial[:0], pcm[whole:]...)
+		pcm = pcm[:whole]
+	}
+	var err error
+	s.samples, err = protocol.DecodeSamples(s.samples[:0], s.format.Encoding, pcm)
+	if err != nil {
+		return dst, err
+	}
+	samples := s.samples
+	if s.mix != nil {
+		s.mono = s.mix.Apply(s.mono[:0], samples)
+		samples = s.mono
+	}
+	return s.Process(dst, samples), nil
+}
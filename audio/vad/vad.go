@@ -0,0 +1,286 @@
+// Package vad detects voice activity in streaming audio without a model.
+//
+// Each analysis frame is scored on energy relative to an adaptive noise
+// floor, zero-crossing rate and spectral flatness. Speech must be loud and
+// sound voiced (low flatness or low zero-crossing rate) to start; once
+// started, loudness alone keeps it going, and a hangover bridges short
+// pauses and unvoiced consonants.
+package vad
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+var ErrInvalidRate = errors.New("vad: invalid sample rate")
+
+const (
+	DefaultFrame       = 20 * time.Millisecond
+	DefaultThreshold   = 10
+	DefaultMinFloor    = -60
+	DefaultMaxFlatness = 0.35
+	DefaultMaxZCR      = 0.25
+	DefaultStart       = 60 * time.Millisecond
+	DefaultHangover    = 300 * time.Millisecond
+)
+
+// Config tunes a Detector. Zero fields take the defaults above.
+type Config struct {
+	Frame       time.Duration // analysis frame length
+	Threshold   float64       // dB above the noise floor that counts as loud
+	MinFloor    float64       // lowest noise floor in dBFS
+	MaxFlatness float64       // spectral flatness below which a frame sounds voiced
+	MaxZCR      float64       // zero crossings per sample below which a frame sounds voiced
+	Start       time.Duration // speech needed before Start is reported
+	Hangover    time.Duration // non-speech needed before Stop is reported
+	MaxSpeech   time.Duration // if set, Stop is forced after this much speech
+	MaxWait     time.Duration // if set, Stop is forced after this long without speech
+}
+
+func (c Config) WithDefaults() Config {
+	if c.Frame <= 0 {
+		c.Frame = DefaultFrame
+	}
+	if c.Threshold == 0 {
+		c.Threshold = DefaultThreshold
+	}
+	if c.MinFloor == 0 {
+		c.MinFloor = DefaultMinFloor
+	}
+	if c.MaxFlatness == 0 {
+		c.MaxFlatness = DefaultMaxFlatness
+	}
+	if c.MaxZCR == 0 {
+		c.MaxZCR = DefaultMaxZCR
+	}
+	if c.Start <= 0 {
+		c.Start = DefaultStart
+	}
+	if c.Hangover <= 0 {
+		c.Hangover = DefaultHangover
+	}
+	return c
+}
+
+type EventKind int
+
+const (
+	Start EventKind = iota + 1
+	Stop
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case Start:
+		return "start"
+	case Stop:
+		return "stop"
+	}
+	return "unknown"
+}
+
+// Event is a change in voice activity. At is the stream position where
+// speech began (Start) or the end of the last speech frame (Stop), counted
+// from the first sample given to the Detector. Timeout marks a Stop forced
+// by Config.MaxSpeech, or by Config.MaxWait when no Start came before it.
+type Event struct {
+	Kind    EventKind
+	At      time.Duration
+	Timeout bool
+}
+
+// Features describes one analysis frame.
+type Features struct {
+	Energy   float64 // dBFS
+	ZCR      float64 // zero crossings per sample
+	Flatness float64 // 0 for a pure tone, near 1 for white noise
+}
+
+// Detector finds speech in mono float32 samples. It keeps state between
+// calls, so chunks need not line up with analysis frames.
+type Detector struct {
+	cfg        Config
+	rate       int
+	frameLen   int
+	startRun   int
+	hangRun    int
+	maxRun     int64 // samples; 0 for no limit
+	maxWait    int64 // samples; 0 for no limit
+	frame      []float32
+	spectrum   *spectrum
+	pos        int64 // samples consumed
+	floor      float64
+	speaking   bool
+	run        int
+	silent     int
+	onset      int64
+	idleFrom   int64 // end of the last speech, or where the stream began
+	lastSpeech int64
+	last       Features
+}
+
+func New(sampleRate int, cfg Config) (*Detector, error) {
+	if sampleRate <= 0 {
+		return nil, ErrInvalidRate
+	}
+	cfg = cfg.WithDefaults()
+	frameLen := int(int64(sampleRate) * int64(cfg.Frame) / int64(time.Second))
+	if frameLen < 16 {
+		return nil, ErrInvalidRate
+	}
+	d := &Detector{
+		cfg:      cfg,
+		rate:     sampleRate,
+		frameLen: frameLen,
+		startRun: frames(cfg.Start, cfg.Frame),
+		hangRun:  frames(cfg.Hangover, cfg.Frame),
+		frame:    make([]float32, 0, frameLen),
+		spectrum: newSpectrum(frameLen, sampleRate),
+		maxRun:   int64(sampleRate) * int64(cfg.MaxSpeech) / int64(time.Second),
+		maxWait:  int64(sampleRate) * int64(cfg.MaxWait) / int64(time.Second),
+	}
+	d.Reset()
+	return d, nil
+}
+
+func frames(d, frame time.Duration) int {
+	n := int((d + frame - 1) / frame)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Reset forgets the noise floor and any speech in progress.
+func (d *Detector) Reset() {
+	d.frame = d.frame[:0]
+	d.pos = 0
+	d.idleFrom = 0
+	d.floor = math.NaN()
+	d.speaking = false
+	d.run, d.silent = 0, 0
+}
+
+func (d *Detector) Speaking() bool { return d.speaking }
+
+// Floor is the current noise floor estimate in dBFS.
+func (d *Detector) Floor() float64 { return d.floor }
+
+// Last returns the features of the most recent complete frame.
+func (d *Detector) Last() Features { return d.last }
+
+// Process analyses samples and appends any activity changes to dst.
+func (d *Detector) Process(dst []Event, samples []float32) []Event {
+	for len(samples) > 0 {
+		n := copy(d.frame[len(d.frame):d.frameLen], samples)
+		d.frame = d.frame[:len(d.frame)+n]
+		samples = samples[n:]
+		if len(d.frame) == d.frameLen {
+			dst = d.step(dst)
+			d.frame = d.frame[:0]
+		}
+	}
+	return dst
+}
+
+func (d *Detector) step(dst []Event) []Event {
+	start := d.pos
+	d.pos += int64(d.frameLen)
+	f := d.analyse(d.frame)
+	d.last = f
+
+	if math.IsNaN(d.floor) {
+		d.floor = math.Max(f.Energy, d.cfg.MinFloor)
+	}
+	loud := f.Energy > d.floor+d.cfg.Threshold
+	voiced := f.Flatness < d.cfg.MaxFlatness || f.ZCR < d.cfg.MaxZCR
+
+	if !d.speaking {
+		if loud && voiced {
+			if d.run == 0 {
+				d.onset = start
+			}
+			d.run++
+			if d.run >= d.startRun {
+				d.speaking = true
+				d.silent = 0
+				d.lastSpeech = d.pos
+				dst = append(dst, Event{Kind: Start, At: d.duration(d.onset)})
+			}
+		} else {
+			d.run = 0
+			d.adapt(f.Energy, 0.05)
+		}
+		if !d.speaking && d.run == 0 && d.maxWait > 0 && d.pos-d.idleFrom >= d.maxWait {
+			d.idleFrom = d.pos
+			dst = append(dst, Event{Kind: Stop, At: d.duration(d.pos), Timeout: true})
+		}
+		return dst
+	}
+
+	if loud {
+		d.silent = 0
+		d.lastSpeech = d.pos
+		// Drift up very slowly so a noise that starts mid-utterance and
+		// never stops cannot hold the detector open forever.
+		d.adapt(f.Energy, 0.0005)
+		if d.maxRun > 0 && d.pos-d.onset >= d.maxRun {
+			d.speaking = false
+			d.run = 0
+			d.idleFrom = d.pos
+			dst = append(dst, Event{Kind: Stop, At: d.duration(d.pos), Timeout: true})
+		}
+		return dst
+	}
+	d.adapt(f.Energy, 0.05)
+	d.silent++
+	if d.silent >= d.hangRun {
+		d.speaking = false
+		d.run = 0
+		d.idleFrom = d.pos
+		dst = append(dst, Event{Kind: Stop, At: d.duration(d.lastSpeech)})
+	}
+	return dst
+}
+
+// adapt moves the noise floor toward energy: quickly when it is quieter,
+// at rate up when it is louder.
+func (d *Detector) adapt(energy, up float64) {
+	if energy < d.floor {
+		d.floor += 0.5 * (energy - d.floor)
+	} else {
+		d.floor += up * (energy - d.floor)
+	}
+	d.floor = math.Max(d.floor, d.cfg.MinFloor)
+}
+
+func (d *Detector) duration(samples int64) time.Duration {
+	return time.Duration(samples * int64(time.Second) / int64(d.rate))
+}
+
+func (d *Detector) analyse(frame []float32) Features {
+	var mean float64
+	for _, v := range frame {
+		mean += float64(v)
+	}
+	mean /= float64(len(frame))
+
+	var power float64
+	crossings := 0
+	prev := float64(frame[0]) - mean
+	for _, v := range frame {
+		x := float64(v) - mean
+		power += x * x
+		if (x >= 0) != (prev >= 0) {
+			crossings++
+		}
+		prev = x
+	}
+	power /= float64(len(frame))
+	return Features{
+		Energy:   10 * math.Log10(power+1e-12),
+		ZCR:      float64(crossings) / float64(len(frame)-1),
+		Flatness: d.spectrum.flatness(frame, mean),
+	}
+}
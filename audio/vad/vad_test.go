@@ -0,0 +1,193 @@
+package vad
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"ion/audio"
+	"ion/protocol"
+)
+
+const rate = 16000
+
+func noise(r *rand.Rand, d time.Duration, amp float64) []float32 {
+	out := make([]float32, int(d.Seconds()*rate))
+	for i := range out {
+		out[i] = float32(r.NormFloat64() * amp)
+	}
+	return out
+}
+
+// voiced is a harmonic series on a 150 Hz fundamental with a little noise,
+// roughly the spectrum of a sustained vowel.
+func voiced(r *rand.Rand, d time.Duration, amp float64) []float32 {
+	out := noise(r, d, amp/100)
+	for i := range out {
+		t := float64(i) / rate
+		var v float64
+		for h := 1; h*150 < 3000; h++ {
+			v += math.Sin(2*math.Pi*150*float64(h)*t) / float64(h)
+		}
+		out[i] += float32(amp * v / 2)
+	}
+	return out
+}
+
+func concat(parts ...[]float32) []float32 {
+	var out []float32
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func near(got, want time.Duration) bool {
+	diff := got - want
+	return diff > -3*DefaultFrame && diff < 3*DefaultFrame
+}
+
+func TestDetectSpeech(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	signal := concat(
+		noise(r, time.Second, 0.003),
+		voiced(r, time.Second, 0.1),
+		noise(r, time.Second, 0.003),
+	)
+	d, err := New(rate, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := d.Process(nil, signal)
+	if len(events) != 2 {
+		t.Fatalf("events %v", events)
+	}
+	if events[0].Kind != Start || !near(events[0].At, time.Second) {
+		t.Errorf("start %v", events[0])
+	}
+	if events[1].Kind != Stop || !near(events[1].At, 2*time.Second) {
+		t.Errorf("stop %v", events[1])
+	}
+	if d.Speaking() {
+		t.Error("still speaking")
+	}
+}
+
+func TestIgnoreNoise(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	signal := concat(
+		noise(r, 500*time.Millisecond, 0.001),
+		noise(r, 3*time.Second, 0.1),
+	)
+	d, _ := New(rate, Config{})
+	if events := d.Process(nil, signal); len(events) != 0 {
+		t.Fatalf("noise triggered %v", events)
+	}
+	if f := d.Floor(); math.Abs(f-20*math.Log10(0.1)) > 3 {
+		t.Errorf("floor %.1f dBFS did not adapt to -20", f)
+	}
+	if l := d.Last(); l.Flatness < DefaultMaxFlatness || l.ZCR < DefaultMaxZCR {
+		t.Errorf("white noise features %+v", l)
+	}
+}
+
+func TestHangoverBridgesPauses(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	signal := concat(
+		noise(r, 500*time.Millisecond, 0.003),
+		voiced(r, 400*time.Millisecond, 0.1),
+		noise(r, 150*time.Millisecond, 0.003),
+		voiced(r, 400*time.Millisecond, 0.1),
+		noise(r, time.Second, 0.003),
+	)
+	d, _ := New(rate, Config{})
+	events := d.Process(nil, signal)
+	if len(events) != 2 || !near(events[1].At, 1450*time.Millisecond) {
+		t.Fatalf("events %v", events)
+	}
+}
+
+func TestStreamChunked(t *testing.T) {
+	r := rand.New(rand.NewPCG(7, 8))
+	mono := concat(
+		noise(r, 500*time.Millisecond, 0.003),
+		voiced(r, 500*time.Millisecond, 0.2),
+		noise(r, 500*time.Millisecond, 0.003),
+	)
+	stereo := make([]float32, 0, 2*len(mono))
+	for _, v := range mono {
+		stereo = append(stereo, v, v)
+	}
+	pcm, _ := protocol.EncodeSamples(nil, protocol.FormatS16LE, stereo)
+
+	d, _ := New(rate, Config{})
+	want := d.Process(nil, mono)
+
+	s, err := NewStream(audio.Format{SampleRate: rate, Channels: 2, Encoding: protocol.FormatS16LE}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Event
+	for len(pcm) > 0 {
+		n := min(len(pcm), 333)
+		if got, err = s.Write(got, pcm[:n]); err != nil {
+			t.Fatal(err)
+		}
+		pcm = pcm[n:]
+	}
+	if len(got) != 2 || len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestInvalidRate(t *testing.T) {
+	if _, err := New(0, Config{}); err != ErrInvalidRate {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestMaxSpeech(t *testing.T) {
+	r := rand.New(rand.NewPCG(9, 10))
+	signal := concat(
+		noise(r, 500*time.Millisecond, 0.003),
+		voiced(r, 2500*time.Millisecond, 0.1),
+	)
+	d, _ := New(rate, Config{MaxSpeech: time.Second})
+	events := d.Process(nil, signal)
+	if len(events) < 2 || events[1].Kind != Stop || !events[1].Timeout || !near(events[1].At, 1500*time.Millisecond) {
+		t.Fatalf("events %v", events)
+	}
+}
+
+func TestMaxWait(t *testing.T) {
+	r := rand.New(rand.NewPCG(11, 12))
+	d, _ := New(rate, Config{MaxWait: time.Second})
+	events := d.Process(nil, noise(r, 2500*time.Millisecond, 0.003))
+	if len(events) != 2 {
+		t.Fatalf("events %v, want two timeouts", events)
+	}
+	for i, ev := range events {
+		if ev.Kind != Stop || !ev.Timeout || !near(ev.At, time.Duration(i+1)*time.Second) {
+			t.Fatalf("events %v", events)
+		}
+	}
+
+	// Speech that starts in time is not cut off, and the wait restarts
+	// when it ends.
+	d, _ = New(rate, Config{MaxWait: time.Second})
+	events = d.Process(nil, concat(
+		noise(r, 500*time.Millisecond, 0.003),
+		voiced(r, 2*time.Second, 0.1),
+		noise(r, 1500*time.Millisecond, 0.003),
+	))
+	if len(events) != 3 || events[0].Kind != Start || events[1].Kind != Stop || events[1].Timeout ||
+		events[2].Kind != Stop || !events[2].Timeout || !near(events[2].At-events[1].At, time.Second+DefaultHangover) {
+		t.Fatalf("events %v", events)
+	}
+}
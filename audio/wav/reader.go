@@ -0,0 +1,155 @@
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"ion/protocol"
+)
+
+// Reader parses the chunks of a WAV file up to "data" and then reads the
+// PCM samples. Chunks it does not need (LIST, fact, ...) are skipped.
+type Reader struct {
+	r         io.Reader
+	header    Header
+	remaining int64 // -1 reads until EOF
+	closer    io.Closer
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, ErrNotWAV
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	rd := &Reader{r: r}
+	haveFmt := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if haveFmt {
+				return nil, ErrNoData
+			}
+			return nil, ErrNotWAV
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return nil, fmt.Errorf("%w: fmt chunk of %d bytes", ErrNotWAV, size)
+			}
+			body := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, ErrNotWAV
+			}
+			h, err := parseFmt(body[:size])
+			if err != nil {
+				return nil, err
+			}
+			rd.header = h
+			haveFmt = true
+		case "data":
+			if !haveFmt {
+				return nil, fmt.Errorf("%w: data before fmt", ErrNotWAV)
+			}
+			rd.remaining = size
+			if size == streamingSize {
+				rd.remaining = -1
+			}
+			return rd, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, ErrNoData
+			}
+		}
+	}
+}
+
+// Open reads the WAV file at path. Close closes the file.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.closer = f
+	return r, nil
+}
+
+func parseFmt(b []byte) (Header, error) {
+	tag := binary.LittleEndian.Uint16(b[0:])
+	h := Header{
+		Channels:   int(binary.LittleEndian.Uint16(b[2:])),
+		SampleRate: int(binary.LittleEndian.Uint32(b[4:])),
+	}
+	bits := int(binary.LittleEndian.Uint16(b[14:]))
+	if tag == formatExtensible {
+		if len(b) < 26 {
+			return Header{}, fmt.Errorf("%w: short extensible fmt", ErrNotWAV)
+		}
+		if valid := int(binary.LittleEndian.Uint16(b[18:])); valid != 0 && valid != bits {
+			return Header{}, fmt.Errorf("%w: %d valid bits in %d-bit container", ErrUnsupported, valid, bits)
+		}
+		tag = binary.LittleEndian.Uint16(b[24:])
+	}
+	switch {
+	case tag == formatPCM && bits == 8:
+		h.Format = protocol.FormatU8
+	case tag == formatPCM && bits == 16:
+		h.Format = protocol.FormatS16LE
+	case tag == formatPCM && bits == 24:
+		h.Format = protocol.FormatS24LE
+	case tag == formatPCM && bits == 32:
+		h.Format = protocol.FormatS32LE
+	case tag == formatFloat && bits == 32:
+		h.Format = protocol.FormatF32LE
+	case tag == formatMulaw && bits == 8:
+		h.Format = protocol.FormatMulaw
+	case tag == formatAlaw && bits == 8:
+		h.Format = protocol.FormatAlaw
+	default:
+		return Header{}, fmt.Errorf("%w: format tag 0x%04x with %d bits", ErrUnsupported, tag, bits)
+	}
+	if err := h.validate(); err != nil {
+		return Header{}, err
+	}
+	return h, nil
+}
+
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Read returns PCM bytes. A data chunk cut short by a truncated file ends
+// with io.EOF rather than an error.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	if r.remaining > 0 && int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.r.Read(p)
+	if r.remaining > 0 {
+		r.remaining -= int64(n)
+	}
+	return n, err
+}
+
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
@@ -0,0 +1,92 @@
+// Package wav reads and writes RIFF/WAVE files holding integer or float PCM.
+package wav
+
+import (
+	"errors"
+	"fmt"
+
+	"ion/protocol"
+)
+
+var (
+	ErrNotWAV      = errors.New("wav: not a RIFF/WAVE file")
+	ErrNoData      = errors.New("wav: no data chunk")
+	ErrUnsupported = errors.New("wav: unsupported sample format")
+)
+
+const (
+	formatPCM        = 0x0001
+	formatFloat      = 0x0003
+	formatAlaw       = 0x0006
+	formatMulaw      = 0x0007
+	formatExtensible = 0xFFFE
+)
+
+// Header describes the PCM data in a WAV file.
+type Header struct {
+	SampleRate int
+	Channels   int
+	Format     protocol.SampleFormat
+}
+
+// FromReady builds a header from the stream format announced in a ready
+// event.
+func FromReady(ev protocol.ReadyEvent) (Header, error) {
+	h := Header{SampleRate: ev.SampleRate, Channels: ev.Channels, Format: ev.Format}
+	return h, h.validate()
+}
+
+// ReadyEvent returns a ready event announcing this header's format.
+func (h Header) ReadyEvent() protocol.ReadyEvent {
+	return protocol.ReadyEvent{
+		Type:       protocol.EventReady,
+		Protocol:   "ion",
+		SampleRate: h.SampleRate,
+		Channels:   h.Channels,
+		Format:     h.Format,
+	}
+}
+
+func (h Header) BitsPerSample() int {
+	return h.Format.BytesPerSample() * 8
+}
+
+func (h Header) BlockAlign() int {
+	return h.Channels * h.Format.BytesPerSample()
+}
+
+func (h Header) ByteRate() int {
+	return h.SampleRate * h.BlockAlign()
+}
+
+func (h Header) tag() uint16 {
+	switch h.Format {
+	case protocol.FormatF32LE:
+		return formatFloat
+	case protocol.FormatMulaw:
+		return formatMulaw
+	case protocol.FormatAlaw:
+		return formatAlaw
+	}
+	return formatPCM
+}
+
+// extensible reports whether the header needs WAVE_FORMAT_EXTENSIBLE, which
+// is required for PCM with more than two channels or more than 16 bits.
+func (h Header) extensible() bool {
+	switch h.tag() {
+	case formatPCM, formatFloat:
+		return h.Channels > 2 || h.BitsPerSample() > 16
+	}
+	return false
+}
+
+func (h Header) validate() error {
+	if h.SampleRate <= 0 || h.Channels <= 0 || h.Channels > 0xFFFF {
+		return fmt.Errorf("%w: %d Hz, %d channels", ErrUnsupported, h.SampleRate, h.Channels)
+	}
+	if !h.Format.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnsupported, h.Format)
+	}
+	return nil
+}
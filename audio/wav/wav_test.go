@@ -0,0 +1,180 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ion/protocol"
+)
+
+func TestRoundtrip(t *testing.T) {
+	for _, tc := range []struct {
+		format   protocol.SampleFormat
+		channels int
+		fmtSize  int
+	}{
+		{protocol.FormatU8, 1, 16},
+		{protocol.FormatS16LE, 2, 16},
+		{protocol.FormatS24LE, 2, 40},
+		{protocol.FormatS32LE, 1, 40},
+		{protocol.FormatF32LE, 6, 40},
+		{protocol.FormatMulaw, 1, 18},
+		{protocol.FormatAlaw, 2, 18},
+	} {
+		t.Run(fmt.Sprintf("%s/%d", tc.format, tc.channels), func(t *testing.T) {
+			h := Header{SampleRate: 48000, Channels: tc.channels, Format: tc.format}
+			path := filepath.Join(t.TempDir(), "x.wav")
+			w, err := Create(path, h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pcm := make([]byte, 3*h.BlockAlign()+1)
+			for i := range pcm {
+				pcm[i] = byte(i * 7)
+			}
+			w.Write(pcm[:len(pcm)/2])
+			w.Write(pcm[len(pcm)/2:])
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			raw, _ := os.ReadFile(path)
+			if got := binary.LittleEndian.Uint32(raw[16:]); int(got) != tc.fmtSize {
+				t.Fatalf("fmt chunk size %d, want %d", got, tc.fmtSize)
+			}
+			if riff := binary.LittleEndian.Uint32(raw[4:]); int(riff) != len(raw)-8 {
+				t.Fatalf("riff size %d, file is %d bytes", riff, len(raw))
+			}
+
+			r, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if r.Header() != h {
+				t.Fatalf("header %+v, want %+v", r.Header(), h)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, pcm) {
+				t.Fatalf("data mismatch: %d bytes, want %d", len(got), len(pcm))
+			}
+		})
+	}
+}
+
+func TestStreamingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{SampleRate: 16000, Channels: 1, Format: protocol.FormatS16LE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte{1, 2, 3, 4})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint32(buf.Bytes()[40:]); size != streamingSize {
+		t.Fatalf("data size %#x, want streaming marker", size)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	if !bytes.Equal(got, []byte{1, 2, 3, 4}) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	h := Header{SampleRate: 8000, Channels: 1, Format: protocol.FormatU8}
+	b, err := Encode(h, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint32(b[4:]); int(size) != len(b)-8 {
+		t.Fatalf("riff size %d for %d bytes", size, len(b))
+	}
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	if r.Header() != h || !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Fatalf("got %+v %v", r.Header(), got)
+	}
+}
+
+func TestReaderSkipsChunks(t *testing.T) {
+	var b []byte
+	b = append(b, "RIFF\x00\x00\x00\x00WAVE"...)
+	b = append(b, "LIST\x03\x00\x00\x00abc\x00"...)
+	b = append(b, "fmt \x10\x00\x00\x00"...)
+	b = binary.LittleEndian.AppendUint16(b, formatPCM)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint32(b, 8000)
+	b = binary.LittleEndian.AppendUint32(b, 16000)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 16)
+	b = append(b, "fact\x04\x00\x00\x00\x02\x00\x00\x00"...)
+	b = append(b, "data\x04\x00\x00\x00\x01\x02\x03\x04"...)
+	b = append(b, "LIST\x02\x00\x00\x00zz"...)
+
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	if !bytes.Equal(got, []byte{1, 2, 3, 4}) {
+		t.Fatalf("got %v", got)
+	}
+
+	if _, err := NewReader(bytes.NewReader(b[:60])); !errors.Is(err, ErrNoData) {
+		t.Fatalf("truncated file: %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("RIFX0000WAVE"))); !errors.Is(err, ErrNotWAV) {
+		t.Fatalf("bad magic: %v", err)
+	}
+}
+
+func TestReaderEmptyData(t *testing.T) {
+	h := Header{SampleRate: 8000, Channels: 1, Format: protocol.FormatU8}
+	b, err := Encode(h, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b, "LIST\x04\x00\x00\x00INFO"...)
+
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(r); len(got) != 0 {
+		t.Fatalf("empty data chunk read as %q", got)
+	}
+}
+
+func TestReadyEvent(t *testing.T) {
+	h, err := FromReady(protocol.ReadyEvent{SampleRate: 8000, Channels: 1, Format: protocol.FormatMulaw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.BitsPerSample() != 8 || h.tag() != formatMulaw {
+		t.Fatalf("header %+v", h)
+	}
+	if ev := h.ReadyEvent(); ev.Validate() != nil || ev.Format != protocol.FormatMulaw || ev.SampleRate != 8000 {
+		t.Fatalf("ready %+v", ev)
+	}
+	if _, err := FromReady(protocol.ReadyEvent{SampleRate: 8000, Channels: 1, Format: "g729"}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("g729: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// Size fields left in the header when the output cannot be rewritten.
+const streamingSize = 0xFFFFFFFF
+
+// ksdataformat subtype GUID tail shared by PCM and IEEE float.
+var subtypeTail = []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// Writer streams PCM into a WAV file. If the destination is an
+// io.WriteSeeker the RIFF and data sizes are patched on Close; otherwise
+// they are left at 0xFFFFFFFF, which most readers treat as "until EOF".
+type Writer struct {
+	w      io.Writer
+	header Header
+	closer io.Closer
+
+	sizeOffset int64 // offset of the data chunk's size field
+	size       int64
+	closed     bool
+}
+
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	wr := &Writer{w: w, header: h}
+	hdr := wr.encodeHeader()
+	wr.sizeOffset = int64(len(hdr) - 4)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// Create writes a new WAV file at path. Close also closes the file.
+func Create(path string, h Header) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, h)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+func (w *Writer) Header() Header {
+	return w.header
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := w.w.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close pads the data chunk to an even length and fixes the header sizes.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	err := w.finish()
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (w *Writer) finish() error {
+	if w.size%2 == 1 {
+		if _, err := w.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	ws, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	riffSize := w.sizeOffset + 4 - 8 + w.size + w.size%2
+	if riffSize > streamingSize {
+		return nil
+	}
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil // not actually seekable, e.g. a pipe
+	}
+	start := end - (w.sizeOffset + 4 + w.size + w.size%2)
+
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(riffSize))
+	if err := writeAt(ws, start+4, b[:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b[:], uint32(w.size))
+	if err := writeAt(ws, start+w.sizeOffset, b[:]); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+func writeAt(ws io.WriteSeeker, off int64, b []byte) error {
+	if _, err := ws.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := ws.Write(b)
+	return err
+}
+
+func (w *Writer) encodeHeader() []byte {
+	h := w.header
+	tag := h.tag()
+	fmtSize := 16
+	switch {
+	case h.extensible():
+		fmtSize = 40
+	case tag != formatPCM:
+		fmtSize = 18 // non-PCM formats carry a cbSize field
+	}
+
+	b := make([]byte, 0, 20+fmtSize+8)
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, streamingSize)
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(fmtSize))
+	if h.extensible() {
+		b = binary.LittleEndian.AppendUint16(b, formatExtensible)
+	} else {
+		b = binary.LittleEndian.AppendUint16(b, tag)
+	}
+	b = binary.LittleEndian.AppendUint16(b, uint16(h.Channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(h.SampleRate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(h.ByteRate()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(h.BlockAlign()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(h.BitsPerSample()))
+	switch fmtSize {
+	case 18:
+		b = binary.LittleEndian.AppendUint16(b, 0)
+	case 40:
+		b = binary.LittleEndian.AppendUint16(b, 22)
+		b = binary.LittleEndian.AppendUint16(b, uint16(h.BitsPerSample()))
+		b = binary.LittleEndian.AppendUint32(b, channelMask(h.Channels))
+		b = binary.LittleEndian.AppendUint16(b, tag)
+		b = append(b, subtypeTail...)
+	}
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, streamingSize)
+	return b
+}
+
+// channelMask assigns the default speaker positions for up to 8 channels.
+func channelMask(channels int) uint32 {
+	switch channels {
+	case 1:
+		return 0x4 // front center
+	case 2:
+		return 0x3
+	case 4:
+		return 0x33 // quad
+	case 6:
+		return 0x3F // 5.1
+	case 8:
+		return 0x63F // 7.1
+	}
+	if channels < 32 {
+		return 1<<channels - 1
+	}
+	return 0
+}
+
+// Encode returns a complete WAV file holding pcm, with the sizes filled in.
+func Encode(h Header, pcm []byte) ([]byte, error) {
+	w := &Writer{header: h}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	b := w.encodeHeader()
+	sizeOffset := len(b) - 4
+	b = append(b, pcm...)
+	if len(pcm)%2 == 1 {
+		b = append(b, 0)
+	}
+	if int64(len(b))-8 > streamingSize {
+		return nil, errors.New("wav: data too large")
+	}
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	binary.LittleEndian.PutUint32(b[sizeOffset:], uint32(len(pcm)))
+	return b, nil
+}
@@ -0,0 +1,66 @@
+package audio
+
+import (
+	"sync"
+
+	"ion/audio/wav"
+)
+
+// WAVSource reads the PCM data of a WAV file. It is not paced.
+type WAVSource struct {
+	r      *wav.Reader
+	format Format
+}
+
+func OpenWAVSource(path string) (*WAVSource, error) {
+	r, err := wav.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	h := r.Header()
+	return &WAVSource{r: r, format: Format{SampleRate: h.SampleRate, Channels: h.Channels, Encoding: h.Format}}, nil
+}
+
+func (s *WAVSource) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *WAVSource) Format() Format {
+	return s.format
+}
+
+func (s *WAVSource) Close() error {
+	return s.r.Close()
+}
+
+// WAVSink streams PCM into a WAV file whose sizes are fixed on Close.
+type WAVSink struct {
+	mu     sync.Mutex
+	w      *wav.Writer
+	format Format
+}
+
+func CreateWAVSink(path string, f Format) (*WAVSink, error) {
+	f = f.WithDefaults()
+	w, err := wav.Create(path, wav.Header{SampleRate: f.SampleRate, Channels: f.Channels, Format: f.Encoding})
+	if err != nil {
+		return nil, err
+	}
+	return &WAVSink{w: w, format: f}, nil
+}
+
+func (s *WAVSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *WAVSink) Format() Format {
+	return s.format
+}
+
+func (s *WAVSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Close()
+}
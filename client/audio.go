@@ -0,0 +1,41 @@
+package client
+
+import (
+	"io"
+	"sync"
+)
+
+type audioReader struct {
+	chunks    chan []byte
+	buf       []byte
+	closeOnce sync.Once
+}
+
+func newAudioReader(depth int) *audioReader {
+	return &audioReader{chunks: make(chan []byte, depth)}
+}
+
+func (a *audioReader) push(p []byte) {
+	select {
+	case a.chunks <- p:
+	default:
+		// Reader is not keeping up; drop the frame rather than stall events.
+	}
+}
+
+func (a *audioReader) close() {
+	a.closeOnce.Do(func() { close(a.chunks) })
+}
+
+func (a *audioReader) Read(p []byte) (int, error) {
+	if len(a.buf) == 0 {
+		chunk, ok := <-a.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		a.buf = chunk
+	}
+	n := copy(p, a.buf)
+	a.buf = a.buf[n:]
+	return n, nil
+}
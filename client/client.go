@@ -0,0 +1,333 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"ion/protocol"
+)
+
+var ErrClosed = errors.New("client: closed")
+
+type Client struct {
+	in     *protocol.Reader
+	out    io.Writer
+	outMu  sync.Mutex
+	closer io.Closer
+
+	ready  protocol.ReadyEvent
+	proto  *protocol.Session
+	tap    atomic.Pointer[protocol.Tap]
+	events chan protocol.Event
+	audio  *audioReader
+
+	startOnce sync.Once
+	done      chan struct{}
+	closeOnce sync.Once
+
+	errMu sync.Mutex
+	err   error
+}
+
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return New(c, c, c), nil
+}
+
+// New wraps an established stream. closer may be nil for streams such as
+// stdin/stdout that must stay open.
+func New(in io.Reader, out io.Writer, closer io.Closer) *Client {
+	return &Client{
+		in:     protocol.NewReader(bufio.NewReader(in)),
+		out:    out,
+		closer: closer,
+		proto:  protocol.NewSession(protocol.RoleClient),
+		events: make(chan protocol.Event, 64),
+		audio:  newAudioReader(256),
+		done:   make(chan struct{}),
+	}
+}
+
+// Handshake sends describe and waits for ready. formats lists the audio
+// formats the client can handle, most preferred first; without any the
+// server picks. Events and audio are only delivered once the handshake has
+// completed.
+func (c *Client) Handshake(ctx context.Context, formats ...protocol.AudioFormat) (protocol.ReadyEvent, error) {
+	describe := protocol.DescribeEvent{Type: protocol.EventDescribe}
+	if len(formats) > 0 {
+		describe.Preferred = &formats[0]
+		describe.Formats = formats
+	}
+	if err := c.Send(describe); err != nil {
+		return protocol.ReadyEvent{}, err
+	}
+
+	type result struct {
+		ready protocol.ReadyEvent
+		err   error
+	}
+	res := make(chan result, 1)
+	go func() {
+		ready, err := c.awaitReady()
+		res <- result{ready, err}
+	}()
+
+	select {
+	case r := <-res:
+		if r.err != nil {
+			return protocol.ReadyEvent{}, r.err
+		}
+		c.ready = r.ready
+		c.startOnce.Do(func() { go c.readLoop() })
+		return r.ready, nil
+	case <-ctx.Done():
+		_ = c.Close()
+		return protocol.ReadyEvent{}, ctx.Err()
+	}
+}
+
+func (c *Client) awaitReady() (protocol.ReadyEvent, error) {
+	for {
+		f, err := c.in.ReadFrame()
+		if err != nil {
+			return protocol.ReadyEvent{}, err
+		}
+		c.tapFrame(protocol.Inbound, f)
+		if f.Type != protocol.FrameTypeJSON {
+			continue
+		}
+
+		ev, err := protocol.DecodeEvent(f.Payload)
+		if err != nil {
+			return protocol.ReadyEvent{}, err
+		}
+		if err := c.proto.Observe(protocol.Inbound, ev); err != nil {
+			continue
+		}
+		switch ev := ev.(type) {
+		case protocol.ReadyEvent:
+			return ev, ev.Validate()
+		case protocol.ErrorEvent:
+			return protocol.ReadyEvent{}, fmt.Errorf("client: server error: %s", ev.Message)
+		}
+	}
+}
+
+func (c *Client) readLoop() {
+	defer close(c.events)
+	defer c.audio.close()
+
+	for {
+		f, err := c.in.ReadFrame()
+		if err != nil {
+			c.setErr(err)
+			return
+		}
+		c.tapFrame(protocol.Inbound, f)
+
+		switch f.Type {
+		case protocol.FrameTypeJSON:
+			ev, err := protocol.DecodeEvent(f.Payload)
+			if err != nil {
+				c.setErr(err)
+				return
+			}
+			if err := c.proto.Observe(protocol.Inbound, ev); err != nil {
+				continue
+			}
+			select {
+			case c.events <- ev:
+			case <-c.done:
+				return
+			}
+		case protocol.FrameTypeAudio:
+			if err := c.proto.ObserveAudio(protocol.Inbound); err != nil {
+				continue
+			}
+			c.audio.push(f.Payload)
+		default:
+			// ignore unknown
+		}
+	}
+}
+
+// SetFrameLimit caps incoming payloads of the given frame type. It must be
+// called before Handshake.
+func (c *Client) SetFrameLimit(frameType byte, max uint32) {
+	c.in.SetLimit(frameType, max)
+}
+
+// Protocol returns the session-model tracker for this connection. Set
+// Strict or OnViolation on it before Handshake.
+func (c *Client) Protocol() *protocol.Session {
+	return c.proto
+}
+
+// SetTap installs a tap that sees every frame sent and received. Pass nil
+// to remove it.
+func (c *Client) SetTap(tap protocol.Tap) {
+	if tap == nil {
+		c.tap.Store(nil)
+		return
+	}
+	c.tap.Store(&tap)
+}
+
+func (c *Client) tapFrame(dir protocol.Direction, f *protocol.Frame) {
+	if tap := c.tap.Load(); tap != nil {
+		(*tap)(dir, f)
+	}
+}
+
+func (c *Client) Ready() protocol.ReadyEvent {
+	return c.ready
+}
+
+// Events is closed when the connection ends; Err reports why.
+func (c *Client) Events() <-chan protocol.Event {
+	return c.events
+}
+
+// Audio returns incoming audio frames as a byte stream. Frames are dropped
+// if the reader falls too far behind.
+func (c *Client) Audio() io.Reader {
+	return c.audio
+}
+
+func (c *Client) Err() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+func (c *Client) setErr(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *Client) Send(ev protocol.Event) error {
+	data, err := protocol.Encode(ev)
+	if err != nil {
+		return err
+	}
+	return c.write(protocol.FrameTypeJSON, data, func() error {
+		return c.proto.Observe(protocol.Outbound, ev)
+	})
+}
+
+func (c *Client) SendAudio(pcm []byte) error {
+	return c.write(protocol.FrameTypeAudio, pcm, func() error {
+		return c.proto.ObserveAudio(protocol.Outbound)
+	})
+}
+
+func (c *Client) write(frameType byte, payload []byte, observe func() error) error {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	if c.closed() {
+		return ErrClosed
+	}
+	if err := observe(); err != nil {
+		return err
+	}
+	if err := protocol.WritePayload(c.out, frameType, payload); err != nil {
+		return err
+	}
+	if c.tap.Load() != nil {
+		c.tapFrame(protocol.Outbound, &protocol.Frame{
+			Version: protocol.VersionByte,
+			Type:    frameType,
+			Length:  uint32(len(payload)),
+			Payload: payload,
+		})
+	}
+	return nil
+}
+
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) Start() error {
+	return c.Send(protocol.StartEvent{Type: protocol.EventStart})
+}
+
+func (c *Client) Stop() error {
+	return c.Send(protocol.StopEvent{Type: protocol.EventStop})
+}
+
+func (c *Client) ASRStart(language string) error {
+	return c.Send(protocol.ASRStartEvent{Type: protocol.EventASRStart, Language: language})
+}
+
+func (c *Client) ASRStop() error {
+	return c.Send(protocol.ASRStopEvent{Type: protocol.EventASRStop})
+}
+
+func (c *Client) TTSStart(text, voice, language string) error {
+	return c.Send(protocol.TTSStartEvent{
+		Type:     protocol.EventTTSStart,
+		Text:     text,
+		Voice:    voice,
+		Language: language,
+	})
+}
+
+// TTSStartStream starts speech whose text follows in TTSChunk calls,
+// ended by TTSEnd. Synthesis starts with the first complete sentence.
+func (c *Client) TTSStartStream(voice, language string) error {
+	return c.Send(protocol.TTSStartEvent{
+		Type:     protocol.EventTTSStart,
+		Voice:    voice,
+		Language: language,
+		Stream:   true,
+	})
+}
+
+func (c *Client) TTSChunk(text string) error {
+	return c.Send(protocol.TTSChunkEvent{Type: protocol.EventTTSChunk, Text: text})
+}
+
+func (c *Client) TTSEnd() error {
+	return c.Send(protocol.TTSEndEvent{Type: protocol.EventTTSEnd})
+}
+
+func (c *Client) TTSStop() error {
+	return c.Send(protocol.TTSStopEvent{Type: protocol.EventTTSStop})
+}
+
+// TTSVoices asks for the server's voices; the answer arrives on Events as
+// a protocol.TTSVoicesResultEvent.
+func (c *Client) TTSVoices(language string) error {
+	return c.Send(protocol.TTSVoicesEvent{Type: protocol.EventTTSVoices, Language: language})
+}
+
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.closer != nil {
+			err = c.closer.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"ion/protocol"
+	"ion/server"
+)
+
+func TestClientHandshake(t *testing.T) {
+	srv := server.New()
+	srv.Handle(protocol.EventDescribe, func(s *server.Session, _ protocol.Event) error {
+		return s.Send(protocol.ReadyEvent{
+			Type:       protocol.EventReady,
+			Protocol:   "ion",
+			SampleRate: 16000,
+			Channels:   1,
+			Format:     "s16le",
+		})
+	})
+	srv.Handle(protocol.EventTTSStart, func(s *server.Session, _ protocol.Event) error {
+		if err := s.Send(protocol.TTSReadyEvent{Type: protocol.EventTTSReady}); err != nil {
+			return err
+		}
+		return s.SendAudio([]byte{1, 2, 3, 4})
+	})
+
+	cc, sc := net.Pipe()
+	go srv.ServeConn(context.Background(), sc)
+
+	c := New(cc, cc, cc)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ready, err := c.Handshake(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready.SampleRate != 16000 || ready.Format != "s16le" {
+		t.Fatalf("unexpected ready: %+v", ready)
+	}
+
+	if err := c.TTSStart("hello", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := <-c.Events()
+	if _, ok := ev.(protocol.TTSReadyEvent); !ok {
+		t.Fatalf("got %#v, want tts.ready", ev)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c.Audio(), buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf[3] != 4 {
+		t.Fatalf("audio mismatch: %v", buf)
+	}
+}
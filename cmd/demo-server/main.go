@@ -1,59 +1,86 @@
 package main
 
 import (
-	"bufio"
-	"encoding/binary"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"math"
 	"net"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"ion/asr"
 	"ion/audio"
+	"ion/audio/vad"
 	"ion/protocol"
+	"ion/record"
+	"ion/server"
+	"ion/tts"
 )
 
 const (
 	defaultSampleRate = 16000
 	defaultChannels   = 1
-	defaultFormat     = "s16le"
+	defaultFormat     = protocol.FormatS16LE
 )
 
 type serverConfig struct {
-	sampleRate             int
-	channels               int
-	format                 string
-	asrBackend             string
-	whisperCLI             string
-	whisperModel           string
-	whisperPartialInterval time.Duration
-	whisperPartialWindow   time.Duration
+	sampleRate         int
+	channels           int
+	format             protocol.SampleFormat
+	asrBackend         string
+	asrParams          map[string]string
+	asrPartialInterval time.Duration
+	maxJSONFrame       uint
+	maxAudioFrame      uint
+	skipOversize       bool
+	strict             bool
+	recordDir          string
+	source             string
+	channelMap         string
+	convert            bool
+	endpoint           bool
+	endpointSilence    time.Duration
+	maxUtterance       time.Duration
+	ttsLead            time.Duration
+	audioWriteTimeout  time.Duration
 }
 
-var cfg serverConfig
+var (
+	cfg         serverConfig
+	sessionSeq  atomic.Int64
+	synthesizer tts.Synthesizer
+)
 
 type connState struct {
-	out   *bufio.Writer
-	outMu sync.Mutex
+	sess     *server.Session
+	recorder *record.Writer
 
 	streamMu   sync.Mutex
 	streamOn   bool
 	streamStop chan struct{}
-	capture    *audio.PipewireCapture
+	capture    audio.Source
 
 	ttsMu   sync.Mutex
 	ttsStop chan struct{}
+	ttsText *ttsText // text of the current tts.start; nil once it is complete
 
 	asrMu     sync.Mutex
+	format    audio.Format     // negotiated with the client
+	inConv    *audio.Converter // client to native; nil if they match
+	convBuf   []byte
 	asrOn     bool
-	asrBuffer []byte
-	asrLang   string
+	asrRec    asr.Recognizer
+	asrCancel context.CancelFunc
+	asrBuffer []byte      // audio held back from asrRec until speech starts
+	asrFed    bool        // asrBuffer has been written to asrRec
+	endpoint  *vad.Stream // on native audio; nil without --endpoint
+	asrSpeech bool
 
 	asrPartialStop chan struct{}
 	asrRunning     bool
@@ -65,35 +92,82 @@ func main() {
 	addr := flag.String("addr", ":10300", "tcp listen address")
 	sampleRate := flag.Int("sample-rate", defaultSampleRate, "sample rate for ready/capture")
 	channels := flag.Int("channels", defaultChannels, "channel count for ready/capture")
-	asrBackend := flag.String("asr", "mock", "asr backend: mock or whisper")
-	whisperCLI := flag.String("whisper-cli", "", "path to whisper-cli")
-	whisperModel := flag.String("whisper-model", "", "path to whisper model")
-	whisperPartials := flag.Duration("whisper-partial-interval", 1*time.Second, "interval for whisper partials")
-	whisperWindow := flag.Duration("whisper-partial-window", 6*time.Second, "audio window for whisper partials")
+	format := flag.String("format", string(defaultFormat), "sample format for ready/capture: s16le, s24le, s32le, f32le, u8, mulaw or alaw")
+	asrBackend := flag.String("asr", "mock", "asr backend: "+strings.Join(asr.Backends(), ", "))
+	asrParams := paramFlag{}
+	flag.Var(asrParams, "asr-param", "backend setting as key=value (repeatable)")
+	whisperCLI := flag.String("whisper-cli", "", "path to whisper-cli (same as --asr-param cli=...)")
+	whisperModel := flag.String("whisper-model", "", "path to whisper model (same as --asr-param model=...)")
+	partialInterval := flag.Duration("whisper-partial-interval", 1*time.Second, "interval for asr partials")
+	whisperWindow := flag.Duration("whisper-partial-window", 6*time.Second, "audio window for whisper partials (same as --asr-param partial_window=...)")
+	maxJSONFrame := flag.Uint("max-json-frame", protocol.DefaultMaxJSONLength, "max JSON frame payload in bytes")
+	maxAudioFrame := flag.Uint("max-audio-frame", protocol.DefaultMaxAudioLength, "max audio frame payload in bytes")
+	skipOversize := flag.Bool("skip-oversize", false, "drop oversized frames instead of closing the connection")
+	strict := flag.Bool("strict", false, "reject frames that violate the session model")
+	recordDir := flag.String("record", "", "directory to write one recording per session into")
+	convert := flag.Bool("convert", true, "accept any client audio format and convert to --sample-rate/--channels/--format")
+	source := flag.String("source", "parec", "capture source URI for start/stop streaming (parec, arecord:DEV, pw-record, cmd:..., wav:PATH, synth:sine)")
+	endpoint := flag.Bool("endpoint", true, "detect speech in asr audio, send vad.start/vad.stop and finish with asr.result on trailing silence")
+	endpointSilence := flag.Duration("endpoint-silence", 800*time.Millisecond, "trailing silence that ends an utterance")
+	maxUtterance := flag.Duration("max-utterance", 15*time.Second, "longest utterance, and longest wait for speech, before asr.result is forced")
+	ttsBackend := flag.String("tts", "tone", "tts backend: "+strings.Join(tts.Backends(), ", "))
+	ttsParams := paramFlag{}
+	flag.Var(ttsParams, "tts-param", "tts backend setting as key=value (repeatable)")
+	ttsVoice := flag.String("tts-voice", "", "voice used when tts.start names none")
+	ttsLanguage := flag.String("tts-language", "", "language used when tts.start names none")
+	ttsLead := flag.Duration("tts-lead", 100*time.Millisecond, "tts audio sent ahead of real time, as an initial burst")
+	audioWriteTimeout := flag.Duration("audio-write-timeout", 2*time.Second, "disconnect a client that takes longer than this to accept an audio frame (0 waits forever)")
+	channelMap := flag.String("channel-map", "", "mix client channels down to --channels before ASR, e.g. 2 or 0.5*1+0.5*2 (channels from 1)")
 	flag.Parse()
 
 	cfg = serverConfig{
-		sampleRate:             *sampleRate,
-		channels:               *channels,
-		format:                 defaultFormat,
-		asrBackend:             *asrBackend,
-		whisperCLI:             *whisperCLI,
-		whisperModel:           *whisperModel,
-		whisperPartialInterval: *whisperPartials,
-		whisperPartialWindow:   *whisperWindow,
+		sampleRate:         *sampleRate,
+		channels:           *channels,
+		format:             protocol.SampleFormat(*format),
+		asrBackend:         *asrBackend,
+		asrParams:          asrParams,
+		asrPartialInterval: *partialInterval,
+		maxJSONFrame:       *maxJSONFrame,
+		maxAudioFrame:      *maxAudioFrame,
+		skipOversize:       *skipOversize,
+		strict:             *strict,
+		recordDir:          *recordDir,
+		source:             *source,
+		convert:            *convert,
+		channelMap:         *channelMap,
+		endpoint:           *endpoint,
+		endpointSilence:    *endpointSilence,
+		maxUtterance:       *maxUtterance,
+		ttsLead:            *ttsLead,
+		audioWriteTimeout:  *audioWriteTimeout,
+	}
+
+	if err := nativeFormat().Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	asrParams.setDefault("cli", *whisperCLI)
+	asrParams.setDefault("model", *whisperModel)
+	asrParams.setDefault("partial_window", whisperWindow.String())
+	if cfg.asrPartialInterval <= 0 {
+		cfg.asrPartialInterval = 2 * time.Second
+	}
+	var err error
+	synthesizer, err = tts.New(*ttsBackend, tts.Options{Voice: *ttsVoice, Language: *ttsLanguage, Params: ttsParams})
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if cfg.asrBackend == "whisper" {
-		if cfg.whisperCLI == "" || cfg.whisperModel == "" {
-			log.Fatal("whisper backend requires --whisper-cli and --whisper-model")
-		}
-		if cfg.whisperPartialInterval <= 0 {
-			cfg.whisperPartialInterval = 2 * time.Second
-		}
-		if cfg.whisperPartialWindow <= 0 {
-			cfg.whisperPartialWindow = 6 * time.Second
-		}
+	// Start one recognizer up front so a bad backend name or missing
+	// setting fails here rather than on the first asr.start.
+	rec, err := asr.New(context.Background(), cfg.asrBackend, asrOptions(""))
+	if err != nil {
+		log.Fatal(err)
 	}
+	_ = rec.Close()
+
+	srv := newServer()
+	ctx := context.Background()
 
 	switch *transport {
 	case "tcp":
@@ -102,117 +176,171 @@ func main() {
 			log.Fatal(err)
 		}
 		log.Println("demo server listening on", *addr)
-		for {
-			c, err := ln.Accept()
-			if err != nil {
-				continue
-			}
-			go handleConn(bufio.NewReader(c), bufio.NewWriter(c), c.Close)
-		}
+		log.Fatal(srv.Serve(ctx, ln))
 	case "stdio":
-		handleConn(bufio.NewReader(os.Stdin), bufio.NewWriter(os.Stdout), func() error { return nil })
+		_ = srv.ServeStream(ctx, os.Stdin, os.Stdout)
 	default:
 		log.Fatalf("unknown transport: %s", *transport)
 	}
 }
 
-func handleConn(in *bufio.Reader, out *bufio.Writer, closer func() error) {
-	defer closer()
-
-	state := &connState{out: out}
-
-	for {
-		f, err := protocol.ReadFrame(in)
-		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				return
-			}
-			log.Println("read frame:", err)
-			return
-		}
-
-		switch f.Type {
-		case protocol.FrameTypeJSON:
-			if err := handleJSON(state, f.Payload); err != nil {
-				log.Println("handleJSON:", err)
-				return
-			}
-		case protocol.FrameTypeAudio:
-			handleAudio(state, f.Payload)
-		default:
-			// ignore unknown
+func newServer() *server.Server {
+	srv := server.New()
+	srv.Limits = map[byte]uint32{
+		protocol.FrameTypeJSON:  uint32(cfg.maxJSONFrame),
+		protocol.FrameTypeAudio: uint32(cfg.maxAudioFrame),
+	}
+	srv.SkipOversize = cfg.skipOversize
+	srv.Strict = cfg.strict
+	srv.AudioWriteTimeout = cfg.audioWriteTimeout
+	srv.OnConnect = func(s *server.Session) {
+		state := &connState{sess: s}
+		if cfg.recordDir != "" {
+			startRecording(state)
 		}
+		s.SetValue(state)
 	}
+	srv.OnDisconnect = func(s *server.Session) {
+		closeConn(stateOf(s))
+	}
+	srv.Handle(protocol.EventDescribe, func(s *server.Session, ev protocol.Event) error {
+		return negotiate(stateOf(s), ev.(protocol.DescribeEvent))
+	})
+	srv.Handle(protocol.EventStart, func(s *server.Session, _ protocol.Event) error {
+		startStream(stateOf(s))
+		return nil
+	})
+	srv.Handle(protocol.EventStop, func(s *server.Session, _ protocol.Event) error {
+		stopStream(stateOf(s))
+		return nil
+	})
+	srv.Handle(protocol.EventASRStart, func(s *server.Session, ev protocol.Event) error {
+		startASR(stateOf(s), ev.(protocol.ASRStartEvent).Language)
+		return nil
+	})
+	srv.Handle(protocol.EventASRStop, func(s *server.Session, _ protocol.Event) error {
+		stopASR(stateOf(s))
+		return nil
+	})
+	srv.Handle(protocol.EventTTSStart, func(s *server.Session, ev protocol.Event) error {
+		startTTS(stateOf(s), ev.(protocol.TTSStartEvent))
+		return nil
+	})
+	srv.Handle(protocol.EventTTSChunk, func(s *server.Session, ev protocol.Event) error {
+		addTTSText(stateOf(s), ev.(protocol.TTSChunkEvent).Text, false)
+		return nil
+	})
+	srv.Handle(protocol.EventTTSEnd, func(s *server.Session, _ protocol.Event) error {
+		addTTSText(stateOf(s), "", true)
+		return nil
+	})
+	srv.Handle(protocol.EventTTSStop, func(s *server.Session, _ protocol.Event) error {
+		stopTTS(stateOf(s))
+		return nil
+	})
+	srv.Handle(protocol.EventTTSVoices, func(s *server.Session, ev protocol.Event) error {
+		go listVoices(stateOf(s), ev.(protocol.TTSVoicesEvent).Language)
+		return nil
+	})
+	srv.HandleAudio(func(s *server.Session, pcm []byte) error {
+		handleAudio(stateOf(s), pcm)
+		return nil
+	})
+	return srv
 }
 
-func handleJSON(state *connState, payload []byte) error {
-	var base protocol.BaseEvent
-	if err := protocol.Decode(payload, &base); err != nil {
-		return err
+func stateOf(s *server.Session) *connState {
+	return s.Value().(*connState)
+}
+
+func startRecording(state *connState) {
+	name := fmt.Sprintf("session-%s-%d.ionrec", time.Now().Format("20060102-150405"), sessionSeq.Add(1))
+	rec, err := record.Create(filepath.Join(cfg.recordDir, name), protocol.RoleServer)
+	if err != nil {
+		log.Println("record:", err)
+		return
 	}
+	state.recorder = rec
+	state.sess.SetTap(rec.Tap)
+}
 
-	switch base.Type {
-	case protocol.EventDescribe:
-		return sendReady(state)
-	case protocol.EventStart:
-		startStream(state)
-	case protocol.EventStop:
-		stopStream(state)
-	case protocol.EventASRStart:
-		var ev protocol.ASRStartEvent
-		if err := protocol.Decode(payload, &ev); err != nil {
-			return err
+func closeConn(state *connState) {
+	stopStream(state)
+	stopTTS(state)
+	if state.recorder != nil {
+		if err := state.recorder.Close(); err != nil {
+			log.Println("record:", err)
 		}
-		startASR(state, ev.Language)
-	case protocol.EventASRStop:
-		stopASR(state)
-	case protocol.EventTTSStart:
-		var ev protocol.TTSStartEvent
-		if err := protocol.Decode(payload, &ev); err != nil {
-			return err
-		}
-		startTTS(state, ev.Text)
-	case protocol.EventTTSStop:
-		stopTTS(state)
-	default:
-		return nil
 	}
-	return nil
-}
 
-func sendReady(state *connState) error {
-	ev := protocol.ReadyEvent{
-		Type:       protocol.EventReady,
-		Protocol:   "ion",
-		SampleRate: cfg.sampleRate,
-		Channels:   cfg.channels,
-		Format:     cfg.format,
+	state.asrMu.Lock()
+	rec, cancel := endASR(state)
+	state.asrMu.Unlock()
+	if rec != nil {
+		cancel()
+		_ = rec.Close()
 	}
-	return writeJSON(state, ev)
 }
 
-func writeJSON(state *connState, ev any) error {
-	data, err := protocol.Encode(ev)
+// nativeFormat is what the ASR path consumes. With --convert, clients may
+// stream in any format and are converted to it.
+func nativeFormat() protocol.AudioFormat {
+	return protocol.AudioFormat{SampleRate: cfg.sampleRate, Channels: cfg.channels, Format: cfg.format}
+}
+
+func negotiate(state *connState, describe protocol.DescribeEvent) error {
+	supported := []protocol.AudioFormat{nativeFormat()}
+	if cfg.convert {
+		supported = append(supported, protocol.AudioFormat{})
+	}
+	f, err := state.sess.Negotiate(describe, supported...)
 	if err != nil {
 		return err
 	}
-	frame := &protocol.Frame{
-		Version: protocol.VersionByte,
-		Type:    protocol.FrameTypeJSON,
-		Length:  uint32(len(data)),
-		Payload: data,
+
+	format := audio.Format{SampleRate: f.SampleRate, Channels: f.Channels, Encoding: f.Format}
+	native := nativeFormat()
+	conv, err := audio.NewConverter(format, audio.Format{SampleRate: native.SampleRate, Channels: native.Channels, Encoding: native.Format})
+	if err != nil {
+		return err
+	}
+	if cfg.channelMap != "" {
+		// A map that does not fit this client's channels falls back to
+		// the default mix rather than failing the session.
+		m, err := audio.ParseMatrix(cfg.channelMap, format.Channels)
+		if err == nil {
+			err = conv.SetMatrix(m)
+		}
+		if err != nil {
+			log.Println("channel map:", err)
+		}
+	}
+	if conv.Identity() {
+		conv = nil
+	} else {
+		log.Printf("client streams %v, converting to %v", f, native)
 	}
-	return writeFrame(state, frame)
-}
 
-func writeFrame(state *connState, frame *protocol.Frame) error {
-	state.outMu.Lock()
-	defer state.outMu.Unlock()
+	state.asrMu.Lock()
+	state.format = format
+	state.inConv = conv
+	state.asrMu.Unlock()
+	return nil
+}
 
-	if err := protocol.WriteFrame(state.out, frame); err != nil {
-		return err
+// clientFormat is the negotiated format for audio sent to the client.
+func clientFormat(state *connState) audio.Format {
+	state.asrMu.Lock()
+	defer state.asrMu.Unlock()
+	if state.format.SampleRate == 0 {
+		native := nativeFormat()
+		return audio.Format{SampleRate: native.SampleRate, Channels: native.Channels, Encoding: native.Format}
 	}
-	return state.out.Flush()
+	return state.format
+}
+
+func writeJSON(state *connState, ev protocol.Event) error {
+	return state.sess.Send(ev)
 }
 
 func startStream(state *connState) {
@@ -223,15 +351,23 @@ func startStream(state *connState) {
 	}
 	state.streamOn = true
 	state.streamStop = make(chan struct{})
-	cap, err := audio.NewPipewireCapture(cfg.sampleRate, cfg.channels)
+	format := clientFormat(state)
+	cap, err := audio.OpenSource(cfg.source, format)
+	if err == nil {
+		var conv audio.Source
+		if conv, err = audio.ConvertSource(cap, format); err != nil {
+			_ = cap.Close()
+		}
+		cap = conv
+	}
 	if err != nil {
-		log.Println("pipewire capture:", err)
+		log.Println("capture:", err)
 		state.streamOn = false
 		state.streamStop = nil
 		return
 	}
 	state.capture = cap
-	go captureLoop(state, state.streamStop)
+	go captureLoop(state, state.streamStop, cap.Format())
 }
 
 func stopStream(state *connState) {
@@ -249,14 +385,37 @@ func stopStream(state *connState) {
 	}
 }
 
-func startTTS(state *connState, text string) {
+func startTTS(state *connState, ev protocol.TTSStartEvent) {
 	state.ttsMu.Lock()
 	defer state.ttsMu.Unlock()
 	if state.ttsStop != nil {
 		close(state.ttsStop)
 	}
 	state.ttsStop = make(chan struct{})
-	go ttsLoop(state, state.ttsStop, text)
+	text := newTTSText()
+	if ev.Stream {
+		// Streamed text is synthesized a sentence at a time as it arrives.
+		text.write(ev.Text, false)
+		state.ttsText = text
+	} else {
+		text.push(ev.Text)
+		state.ttsText = nil
+	}
+	go ttsLoop(state, state.ttsStop, ev, text)
+}
+
+// addTTSText handles tts.chunk and tts.end.
+func addTTSText(state *connState, chunk string, end bool) {
+	state.ttsMu.Lock()
+	defer state.ttsMu.Unlock()
+	if state.ttsText == nil {
+		_ = writeJSON(state, protocol.ErrorEvent{Type: protocol.EventError, Message: "no streamed tts.start in progress"})
+		return
+	}
+	state.ttsText.write(chunk, end)
+	if end {
+		state.ttsText = nil
+	}
 }
 
 func stopTTS(state *connState) {
@@ -266,84 +425,302 @@ func stopTTS(state *connState) {
 		close(state.ttsStop)
 		state.ttsStop = nil
 	}
+	state.ttsText = nil
+}
+
+// maxTTSSegment bounds how much streamed text waits for a sentence end.
+const maxTTSSegment = 300
+
+// ttsText queues the segments of one tts.start for ttsLoop.
+type ttsText struct {
+	mu       sync.Mutex
+	seg      tts.Segmenter
+	segments []string
+	ended    bool
+	notify   chan struct{}
+}
+
+func newTTSText() *ttsText {
+	return &ttsText{seg: tts.Segmenter{MaxLength: maxTTSSegment}, notify: make(chan struct{}, 1)}
+}
+
+// push queues text as one segment and ends the input.
+func (t *ttsText) push(text string) {
+	t.mu.Lock()
+	t.segments = append(t.segments, text)
+	t.ended = true
+	t.mu.Unlock()
+}
+
+func (t *ttsText) write(chunk string, end bool) {
+	t.mu.Lock()
+	t.segments = append(t.segments, t.seg.Write(chunk)...)
+	if end {
+		if rest := t.seg.Flush(); rest != "" {
+			t.segments = append(t.segments, rest)
+		}
+		t.ended = true
+	}
+	t.mu.Unlock()
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for the next segment. It returns false once the input has
+// ended and every segment has been taken, or when ctx is done.
+func (t *ttsText) next(ctx context.Context) (string, bool) {
+	for {
+		t.mu.Lock()
+		if len(t.segments) > 0 {
+			seg := t.segments[0]
+			t.segments = t.segments[1:]
+			t.mu.Unlock()
+			return seg, true
+		}
+		ended := t.ended
+		t.mu.Unlock()
+		if ended {
+			return "", false
+		}
+		select {
+		case <-t.notify:
+		case <-ctx.Done():
+			return "", false
+		}
+	}
+}
+
+func asrOptions(language string) asr.Options {
+	native := nativeFormat()
+	return asr.Options{
+		Format:   audio.Format{SampleRate: native.SampleRate, Channels: native.Channels, Encoding: native.Format},
+		Language: strings.TrimSpace(language),
+		Params:   cfg.asrParams,
+	}
 }
 
 func startASR(state *connState, language string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rec, err := asr.New(ctx, cfg.asrBackend, asrOptions(language))
+	if err != nil {
+		cancel()
+		log.Println("asr:", err)
+		_ = writeJSON(state, protocol.ASRErrorEvent{
+			Type:    protocol.EventASRError,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	state.asrMu.Lock()
+	if old, oldCancel := endASR(state); old != nil {
+		oldCancel()
+		_ = old.Close()
+	}
 	state.asrOn = true
+	state.asrRec = rec
+	state.asrCancel = cancel
 	state.asrBuffer = nil
-	state.asrLang = strings.TrimSpace(language)
+	state.asrFed = false
 	state.asrLastPartial = ""
-	if state.asrPartialStop != nil {
-		close(state.asrPartialStop)
+	state.asrSpeech = false
+	state.endpoint = nil
+	if cfg.endpoint {
+		state.endpoint, err = vad.NewStream(asrOptions("").Format, vad.Config{
+			Hangover:  cfg.endpointSilence,
+			MaxSpeech: cfg.maxUtterance,
+			MaxWait:   cfg.maxUtterance,
+		})
+		if err != nil {
+			log.Println("endpoint:", err)
+		}
 	}
 	state.asrPartialStop = make(chan struct{})
+	go asrPartialLoop(state, state.asrPartialStop)
 	state.asrMu.Unlock()
 
 	_ = writeJSON(state, protocol.ASRPartialEvent{
 		Type: protocol.EventASRPartial,
 		Text: "listening...",
 	})
-
-	if cfg.asrBackend == "whisper" {
-		go asrPartialLoop(state, state.asrPartialStop)
-	}
 }
 
-func stopASR(state *connState) {
-	state.asrMu.Lock()
+// endASR detaches the current recognizer, feeding it any audio still held
+// back, and stops partials. The caller holds asrMu.
+func endASR(state *connState) (asr.Recognizer, context.CancelFunc) {
 	if state.asrPartialStop != nil {
 		close(state.asrPartialStop)
 		state.asrPartialStop = nil
 	}
+	rec, cancel := state.asrRec, state.asrCancel
+	if rec != nil {
+		feedASR(state)
+	}
 	state.asrOn = false
-	buffer := append([]byte(nil), state.asrBuffer...)
-	lang := state.asrLang
+	state.asrRec = nil
+	state.asrCancel = nil
+	state.asrBuffer = nil
+	return rec, cancel
+}
+
+// feedASR writes the held audio to the recognizer; audio after it goes
+// straight through. The caller holds asrMu.
+func feedASR(state *connState) {
+	if state.asrFed {
+		return
+	}
+	state.asrFed = true
+	if len(state.asrBuffer) > 0 {
+		if err := state.asrRec.Write(state.asrBuffer); err != nil {
+			log.Println("asr write:", err)
+		}
+	}
+	state.asrBuffer = nil
+}
+
+// dropASR ends a turn in which the endpointer heard no speech with an empty
+// asr.result, without running the recognizer on the noise held back.
+func dropASR(state *connState) {
+	state.asrMu.Lock()
+	if !state.asrOn {
+		state.asrMu.Unlock()
+		return
+	}
+	state.asrBuffer = nil
+	state.asrFed = true
+	rec, cancel := endASR(state)
 	state.asrMu.Unlock()
 
-	if cfg.asrBackend == "whisper" {
-		go func() {
-			text, err := runWhisper(buffer, lang)
-			if err != nil {
-				_ = writeJSON(state, protocol.ASRErrorEvent{
-					Type:    protocol.EventASRError,
-					Message: err.Error(),
-				})
-				return
-			}
-			if text == "" {
-				return
-			}
-			_ = writeJSON(state, protocol.ASRResultEvent{
-				Type: protocol.EventASRResult,
-				Text: text,
+	cancel()
+	_ = rec.Close()
+	_ = writeJSON(state, protocol.ASRResultEvent{Type: protocol.EventASRResult})
+}
+
+func stopASR(state *connState) {
+	finishASR(state)
+}
+
+// finishASR ends the utterance, whether the client sent asr.stop or the
+// endpointer heard it end, and always answers with asr.result or asr.error
+// so the turn completes.
+func finishASR(state *connState) {
+	state.asrMu.Lock()
+	if !state.asrOn {
+		state.asrMu.Unlock()
+		return
+	}
+	rec, cancel := endASR(state)
+	state.asrMu.Unlock()
+
+	go func() {
+		defer cancel()
+		defer rec.Close()
+		text, err := rec.Final(context.Background())
+		if err != nil {
+			_ = writeJSON(state, protocol.ASRErrorEvent{
+				Type:    protocol.EventASRError,
+				Message: err.Error(),
 			})
-		}()
-	} else {
+			return
+		}
 		_ = writeJSON(state, protocol.ASRResultEvent{
 			Type: protocol.EventASRResult,
-			Text: "demo transcript (replace with Whisper)",
+			Text: text,
 		})
-	}
+	}()
 }
 
 func handleAudio(state *connState, payload []byte) {
 	state.asrMu.Lock()
-	on := state.asrOn
-	if on {
-		state.asrBuffer = append(state.asrBuffer, payload...)
-		if cfg.whisperPartialWindow > 0 {
-			maxBytes := int(cfg.whisperPartialWindow.Seconds()) * cfg.sampleRate * cfg.channels * 2 * 2
-			if maxBytes > 0 && len(state.asrBuffer) > maxBytes {
-				state.asrBuffer = state.asrBuffer[len(state.asrBuffer)-maxBytes:]
+	if !state.asrOn {
+		state.asrMu.Unlock()
+		return
+	}
+	if state.inConv != nil {
+		var err error
+		state.convBuf, err = state.inConv.Convert(state.convBuf[:0], payload)
+		if err != nil {
+			state.asrMu.Unlock()
+			log.Println("convert audio:", err)
+			return
+		}
+		payload = state.convBuf
+	}
+
+	var events []vad.Event
+	started := false
+	idle := -1 // index of a Stop that no speech came before
+	if state.endpoint != nil {
+		var err error
+		if events, err = state.endpoint.Write(nil, payload); err != nil {
+			log.Println("endpoint:", err)
+		}
+		for i, ev := range events {
+			if ev.Kind == vad.Stop && !state.asrSpeech && idle < 0 {
+				idle = i
 			}
+			started = started || ev.Kind == vad.Start
+			state.asrSpeech = ev.Kind == vad.Start
+		}
+	}
+	if state.endpoint != nil && !state.asrFed && !state.asrSpeech && !started {
+		// Until speech is heard the audio is held back, up to
+		// --max-utterance of it. An asr.stop before then transcribes all
+		// of it, in case the endpointer missed quiet speech.
+		state.asrBuffer = keepLast(append(state.asrBuffer, payload...), pcmBytes(state.endpoint.Format(), cfg.maxUtterance))
+	} else {
+		if state.endpoint != nil && !state.asrFed {
+			// Speech started: the recognizer gets it with a short pre-roll
+			// so the onset is included, not the silence before it.
+			state.asrBuffer = keepLast(state.asrBuffer, pcmBytes(state.endpoint.Format(), preroll))
+		}
+		feedASR(state)
+		if err := state.asrRec.Write(payload); err != nil {
+			log.Println("asr write:", err)
 		}
 	}
 	state.asrMu.Unlock()
+
+	for i, ev := range events {
+		switch ev.Kind {
+		case vad.Start:
+			_ = writeJSON(state, protocol.VADStartEvent{Type: protocol.EventVADStart})
+		case vad.Stop:
+			if i == idle {
+				log.Printf("no speech in %v, finishing", cfg.maxUtterance)
+				dropASR(state)
+				return
+			}
+			if ev.Timeout {
+				log.Printf("utterance reached %v, finishing", cfg.maxUtterance)
+			}
+			_ = writeJSON(state, protocol.VADStopEvent{Type: protocol.EventVADStop})
+			finishASR(state)
+			return
+		}
+	}
+}
+
+// preroll is how much audio before detected speech the recognizer gets.
+const preroll = 500 * time.Millisecond
+
+// pcmBytes is the size of d of audio in format f, in whole frames.
+func pcmBytes(f audio.Format, d time.Duration) int {
+	return int(time.Duration(f.SampleRate)*d/time.Second) * f.FrameSize()
+}
+
+// keepLast drops all but the last n bytes of b. A non-positive n keeps all.
+func keepLast(b []byte, n int) []byte {
+	if n > 0 && len(b) > n {
+		return b[len(b)-n:]
+	}
+	return b
 }
 
 func asrPartialLoop(state *connState, stop <-chan struct{}) {
-	ticker := time.NewTicker(cfg.whisperPartialInterval)
+	ticker := time.NewTicker(cfg.asrPartialInterval)
 	defer ticker.Stop()
 
 	for {
@@ -354,36 +731,19 @@ func asrPartialLoop(state *connState, stop <-chan struct{}) {
 		}
 
 		state.asrMu.Lock()
-		if !state.asrOn || state.asrRunning {
+		rec := state.asrRec
+		if !state.asrOn || !state.asrFed || state.asrRunning {
 			state.asrMu.Unlock()
 			continue
 		}
-		buffer := append([]byte(nil), state.asrBuffer...)
-		lang := state.asrLang
 		state.asrRunning = true
 		state.asrMu.Unlock()
 
-		minBytes := cfg.sampleRate * cfg.channels * 2 / 2
-		if len(buffer) < minBytes {
-			state.asrMu.Lock()
-			state.asrRunning = false
-			state.asrMu.Unlock()
-			continue
-		}
-
-		window := buffer
-		if cfg.whisperPartialWindow > 0 {
-			windowBytes := int(cfg.whisperPartialWindow.Seconds()) * cfg.sampleRate * cfg.channels * 2
-			if windowBytes > 0 && len(window) > windowBytes {
-				window = window[len(window)-windowBytes:]
-			}
-		}
-
-		text, err := runWhisper(window, lang)
+		text, err := rec.Partial(context.Background())
 
 		state.asrMu.Lock()
 		state.asrRunning = false
-		if !state.asrOn || err != nil || text == "" || text == state.asrLastPartial {
+		if state.asrRec != rec || err != nil || text == "" || text == state.asrLastPartial {
 			state.asrMu.Unlock()
 			if err != nil {
 				_ = writeJSON(state, protocol.ASRErrorEvent{
@@ -403,169 +763,8 @@ func asrPartialLoop(state *connState, stop <-chan struct{}) {
 	}
 }
 
-func runWhisper(pcm []byte, lang string) (string, error) {
-	if cfg.whisperCLI == "" || cfg.whisperModel == "" {
-		return "", nil
-	}
-	if len(pcm) == 0 {
-		return "", nil
-	}
-	samples := bytesToInt16(pcm)
-	if cfg.channels > 1 {
-		samples = downmixMono(samples, cfg.channels)
-	}
-	if cfg.sampleRate != defaultSampleRate {
-		samples = resampleLinear(samples, cfg.sampleRate, defaultSampleRate)
-	}
-
-	tmp, err := os.CreateTemp("", "ion-whisper-*.wav")
-	if err != nil {
-		return "", err
-	}
-	tmpPath := tmp.Name()
-	if err := writeWAV(tmp, samples, defaultSampleRate, 1); err != nil {
-		_ = tmp.Close()
-		_ = os.Remove(tmpPath)
-		return "", err
-	}
-	_ = tmp.Close()
-	defer os.Remove(tmpPath)
-
-	args := []string{"-m", cfg.whisperModel, "-f", tmpPath, "--no-timestamps"}
-	if strings.TrimSpace(lang) != "" {
-		args = append(args, "-l", lang)
-	}
-	out, err := exec.Command(cfg.whisperCLI, args...).CombinedOutput()
-	if err != nil {
-		msg := strings.TrimSpace(string(out))
-		if msg == "" {
-			return "", fmt.Errorf("whisper exec: %w", err)
-		}
-		return "", fmt.Errorf("whisper exec: %w: %s", err, msg)
-	}
-	return extractTranscript(string(out)), nil
-}
-
-func extractTranscript(output string) string {
-	lines := strings.Split(output, "\n")
-	for i := len(lines) - 1; i >= 0; i-- {
-		line := strings.TrimSpace(lines[i])
-		if line == "" {
-			continue
-		}
-		if strings.HasPrefix(line, "whisper_") || strings.HasPrefix(line, "main:") || strings.HasPrefix(line, "system_info:") {
-			continue
-		}
-		if strings.HasPrefix(line, "[") && strings.Contains(line, "-->") {
-			continue
-		}
-		return line
-	}
-	return ""
-}
-
-func bytesToInt16(pcm []byte) []int16 {
-	if len(pcm)%2 != 0 {
-		pcm = pcm[:len(pcm)-1]
-	}
-	out := make([]int16, len(pcm)/2)
-	for i := 0; i < len(out); i++ {
-		out[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
-	}
-	return out
-}
-
-func downmixMono(samples []int16, channels int) []int16 {
-	if channels <= 1 {
-		return samples
-	}
-	frames := len(samples) / channels
-	out := make([]int16, frames)
-	for i := 0; i < frames; i++ {
-		sum := 0
-		for ch := 0; ch < channels; ch++ {
-			sum += int(samples[i*channels+ch])
-		}
-		out[i] = int16(sum / channels)
-	}
-	return out
-}
-
-func resampleLinear(samples []int16, inRate, outRate int) []int16 {
-	if inRate == outRate || len(samples) == 0 {
-		return samples
-	}
-	ratio := float64(inRate) / float64(outRate)
-	outLen := int(math.Round(float64(len(samples)) / ratio))
-	if outLen <= 1 {
-		return samples
-	}
-	out := make([]int16, outLen)
-	for i := 0; i < outLen; i++ {
-		pos := float64(i) * ratio
-		idx := int(pos)
-		if idx >= len(samples)-1 {
-			out[i] = samples[len(samples)-1]
-			continue
-		}
-		frac := pos - float64(idx)
-		s0 := float64(samples[idx])
-		s1 := float64(samples[idx+1])
-		out[i] = int16(s0*(1-frac) + s1*frac)
-	}
-	return out
-}
-
-func writeWAV(w io.Writer, samples []int16, rate, channels int) error {
-	dataSize := uint32(len(samples) * 2)
-	if _, err := w.Write([]byte("RIFF")); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(36)+dataSize); err != nil {
-		return err
-	}
-	if _, err := w.Write([]byte("WAVE")); err != nil {
-		return err
-	}
-	if _, err := w.Write([]byte("fmt ")); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(16)); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint16(1)); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint16(channels)); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(rate)); err != nil {
-		return err
-	}
-	byteRate := uint32(rate * channels * 2)
-	if err := binary.Write(w, binary.LittleEndian, byteRate); err != nil {
-		return err
-	}
-	blockAlign := uint16(channels * 2)
-	if err := binary.Write(w, binary.LittleEndian, blockAlign); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint16(16)); err != nil {
-		return err
-	}
-	if _, err := w.Write([]byte("data")); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, dataSize); err != nil {
-		return err
-	}
-	return binary.Write(w, binary.LittleEndian, samples)
-}
-
-func captureLoop(state *connState, stop <-chan struct{}) {
-	framesPerChunk := cfg.sampleRate / 50
-	frameSize := 2 * cfg.channels
-	buf := make([]byte, framesPerChunk*frameSize)
+func captureLoop(state *connState, stop <-chan struct{}, format audio.Format) {
+	buf := make([]byte, format.SampleRate/50*format.FrameSize())
 
 	for {
 		select {
@@ -583,13 +782,7 @@ func captureLoop(state *connState, stop <-chan struct{}) {
 
 		n, err := cap.Read(buf)
 		if n > 0 {
-			frame := &protocol.Frame{
-				Version: protocol.VersionByte,
-				Type:    protocol.FrameTypeAudio,
-				Length:  uint32(n),
-				Payload: buf[:n],
-			}
-			if werr := writeFrame(state, frame); werr != nil {
+			if werr := state.sess.SendAudio(buf[:n]); werr != nil {
 				log.Println("write audio frame:", werr)
 				return
 			}
@@ -604,50 +797,164 @@ func captureLoop(state *connState, stop <-chan struct{}) {
 	}
 }
 
-func ttsLoop(state *connState, stop <-chan struct{}, text string) {
-	_ = writeJSON(state, protocol.TTSReadyEvent{Type: protocol.EventTTSReady})
-
-	length := 0.6 + float64(len(text))*0.04
-	if length < 0.6 {
-		length = 0.6
+// listVoices answers tts.voices. A failed listing is a plain error rather
+// than tts.error, which would end whatever utterance is playing.
+func listVoices(state *connState, language string) {
+	voices, err := tts.Voices(context.Background(), synthesizer, language)
+	if err != nil {
+		log.Println("tts voices:", err)
+		_ = writeJSON(state, protocol.ErrorEvent{Type: protocol.EventError, Message: err.Error()})
+		return
 	}
-	if length > 4.0 {
-		length = 4.0
+	if voices == nil {
+		voices = []protocol.Voice{}
 	}
+	_ = writeJSON(state, protocol.TTSVoicesResultEvent{Type: protocol.EventTTSVoicesResult, Voices: voices})
+}
 
-	framesPerChunk := cfg.sampleRate / 50
-	frameSize := 2 * cfg.channels
-	buf := make([]byte, framesPerChunk*frameSize)
-	phase := 0.0
-	step := (2 * math.Pi * 660.0) / float64(cfg.sampleRate)
-	chunks := int(math.Ceil(length / 0.02))
-
-	for i := 0; i < chunks; i++ {
+func ttsLoop(state *connState, stop <-chan struct{}, ev protocol.TTSStartEvent, text *ttsText) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
 		select {
 		case <-stop:
-			return
-		default:
+			cancel()
+		case <-ctx.Done():
 		}
-		for j := 0; j < framesPerChunk; j++ {
-			val := int16(math.Sin(phase) * 0.2 * 32767)
-			binary.LittleEndian.PutUint16(buf[j*2:], uint16(val))
-			phase += step
-			if phase > 2*math.Pi {
-				phase -= 2 * math.Pi
+	}()
+
+	req := tts.Request{Voice: ev.Voice, Language: ev.Language, Rate: ev.Rate}
+	if err := tts.CheckVoice(ctx, synthesizer, req.Voice); err != nil {
+		cancel()
+		ttsFailed(state, err)
+		return
+	}
+
+	// Segments are synthesized in order, one ahead of the one playing, so
+	// the next is ready by the time the current one ends.
+	sources := make(chan audio.Source, 1)
+	synthErr := make(chan error, 1)
+	go func() {
+		defer close(sources)
+		for {
+			seg, ok := text.next(ctx)
+			if !ok {
+				return
 			}
+			req.Text = seg
+			src, err := synthesizer.Synthesize(ctx, req, clientFormat(state))
+			if err != nil {
+				synthErr <- err
+				return
+			}
+			select {
+			case sources <- src:
+			case <-ctx.Done():
+				src.Close()
+				return
+			}
+		}
+	}()
+	defer func() {
+		cancel()
+		for src := range sources {
+			src.Close()
 		}
-		frame := &protocol.Frame{
-			Version: protocol.VersionByte,
-			Type:    protocol.FrameTypeAudio,
-			Length:  uint32(len(buf)),
-			Payload: buf,
+	}()
+
+	format := clientFormat(state)
+	out, err := server.NewPacedWriter(state.sess, protocol.AudioFormat{
+		SampleRate: format.SampleRate,
+		Channels:   format.Channels,
+		Format:     format.Encoding,
+	}, cfg.ttsLead)
+	if err != nil {
+		ttsFailed(state, err)
+		return
+	}
+	defer func() {
+		if out.Underruns > 0 {
+			log.Printf("tts: audio fell behind real time %d times", out.Underruns)
 		}
-		if err := writeFrame(state, frame); err != nil {
-			log.Println("write tts audio:", err)
+	}()
+
+	ready := false
+	for src := range sources {
+		if !ready {
+			_ = writeJSON(state, protocol.TTSReadyEvent{Type: protocol.EventTTSReady})
+			ready = true
+		}
+		err := playTTS(ctx, out, src)
+		src.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			ttsFailed(state, err)
 			return
 		}
-		time.Sleep(20 * time.Millisecond)
 	}
-
+	if ctx.Err() != nil {
+		return
+	}
+	select {
+	case err := <-synthErr:
+		ttsFailed(state, err)
+		return
+	default:
+	}
+	if !ready {
+		_ = writeJSON(state, protocol.TTSReadyEvent{Type: protocol.EventTTSReady})
+	}
 	_ = writeJSON(state, protocol.TTSDoneEvent{Type: protocol.EventTTSDone})
 }
+
+// playTTS sends src in 20ms audio frames, paced by out.
+func playTTS(ctx context.Context, out *server.PacedWriter, src audio.Source) error {
+	format := src.Format()
+	buf := make([]byte, format.SampleRate/50*format.FrameSize())
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if err := out.Write(ctx, buf[:n]); err != nil {
+				return fmt.Errorf("write tts audio: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func ttsFailed(state *connState, err error) {
+	log.Println("tts:", err)
+	_ = writeJSON(state, protocol.TTSErrorEvent{Type: protocol.EventTTSError, Message: err.Error()})
+}
+
+// paramFlag collects repeated key=value flags.
+type paramFlag map[string]string
+
+func (p paramFlag) String() string {
+	var parts []string
+	for k, v := range p {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p paramFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	p[k] = v
+	return nil
+}
+
+func (p paramFlag) setDefault(k, v string) {
+	if _, ok := p[k]; !ok && v != "" {
+		p[k] = v
+	}
+}
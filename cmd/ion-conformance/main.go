@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"ion/conformance"
+)
+
+func main() {
+	addr := flag.String("addr", "", "server under test: tcp address to connect to")
+	listen := flag.String("listen", "", "client under test: tcp address to accept connections on")
+	profiles := flag.String("profile", "core,asr,tts,satellite", "comma separated profiles to run")
+	jsonOut := flag.Bool("json", false, "write the report as JSON")
+	list := flag.Bool("list", false, "list scenarios and exit")
+	timeout := flag.Duration("timeout", 2*time.Minute, "overall time limit")
+	flag.Parse()
+
+	if (*addr == "") == (*listen == "") {
+		log.Fatal("exactly one of --addr or --listen is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var (
+		role      string
+		target    string
+		connect   conformance.Connect
+		scenarios []conformance.Scenario
+	)
+	if *addr != "" {
+		role, target = "server", *addr
+		scenarios = conformance.ServerScenarios()
+		connect = func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", *addr)
+		}
+	} else {
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer ln.Close()
+		role, target = "client", *listen
+		scenarios = conformance.ClientScenarios()
+		connect = func(ctx context.Context) (net.Conn, error) {
+			log.Println("waiting for client connection on", ln.Addr())
+			return accept(ctx, ln)
+		}
+	}
+
+	scenarios = conformance.Select(scenarios, splitList(*profiles)...)
+
+	if *list {
+		for _, s := range scenarios {
+			fmt.Printf("%-32s %s\n", s.ID(), s.Description)
+		}
+		return
+	}
+
+	report := conformance.Run(ctx, role, target, connect, scenarios)
+
+	var err error
+	if *jsonOut {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+func accept(ctx context.Context, ln net.Listener) (net.Conn, error) {
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	res := make(chan result, 1)
+	go func() {
+		c, err := ln.Accept()
+		res <- result{c, err}
+	}()
+	select {
+	case r := <-res:
+		return r.c, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ion/audio"
+	"ion/audio/wav"
+	"ion/protocol"
+)
+
+const maxDumpFrame = 16 << 20
+
+type options struct {
+	compact   bool
+	noAudio   bool
+	wavPrefix string
+}
+
+var outMu sync.Mutex
+
+func main() {
+	listen := flag.String("listen", "", "proxy: tcp address to accept clients on")
+	upstream := flag.String("upstream", "", "proxy: tcp address of the real server")
+	file := flag.String("file", "", "read a raw ION byte stream from a capture file ('-' for stdin)")
+	direction := flag.String("direction", "s->c", "direction label for --file")
+	compact := flag.Bool("compact", false, "print JSON on a single line")
+	noAudio := flag.Bool("no-audio", false, "do not print audio frames")
+	wavPrefix := flag.String("wav", "", "write each direction's audio to PREFIX-<conn>-<dir>.wav")
+	flag.Parse()
+
+	opts := options{compact: *compact, noAudio: *noAudio, wavPrefix: *wavPrefix}
+
+	switch {
+	case *file != "":
+		if err := dumpFile(*file, *direction, opts); err != nil {
+			log.Fatal(err)
+		}
+	case *listen != "" && *upstream != "":
+		if err := runProxy(*listen, *upstream, opts); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatal("use --file PATH or --listen ADDR --upstream ADDR")
+	}
+}
+
+func runProxy(listen, upstream string, opts options) error {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	log.Printf("ion-dump proxying %s -> %s", listen, upstream)
+	for id := 1; ; id++ {
+		c, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			continue
+		}
+		go handleProxy(id, c, upstream, opts)
+	}
+}
+
+func handleProxy(id int, client net.Conn, upstream string, opts options) {
+	defer client.Close()
+
+	server, err := net.Dial("tcp", upstream)
+	if err != nil {
+		log.Printf("[%d] dial upstream: %v", id, err)
+		return
+	}
+	defer server.Close()
+
+	d := newConnDump(id, opts)
+	defer d.close()
+	d.note("connected %s -> %s", client.RemoteAddr(), upstream)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		d.pump("c->s", client, server)
+		done <- struct{}{}
+	}()
+	go func() {
+		d.pump("s->c", server, client)
+		done <- struct{}{}
+	}()
+	<-done
+	_ = client.Close()
+	_ = server.Close()
+	<-done
+	d.note("disconnected")
+}
+
+func dumpFile(path, dir string, opts options) error {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	d := newConnDump(1, opts)
+	defer d.close()
+	d.clock = func() string { return fmt.Sprintf("@%-10d", d.offset) }
+
+	counter := &countingReader{r: bufio.NewReader(in)}
+	rd := newDumpReader(counter)
+	for {
+		d.offset = counter.n
+		f, err := rd.ReadFrame()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			var tooLarge *protocol.FrameTooLargeError
+			if errors.As(err, &tooLarge) && tooLarge.Skipped {
+				d.note("%s skipped oversized frame: %v", dir, err)
+				continue
+			}
+			return fmt.Errorf("offset %d: %w", d.offset, err)
+		}
+		d.frame(dir, f)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newDumpReader(r io.Reader) *protocol.Reader {
+	rd := protocol.NewReader(r)
+	rd.SetLimit(protocol.FrameTypeJSON, maxDumpFrame)
+	rd.SetLimit(protocol.FrameTypeAudio, maxDumpFrame)
+	rd.MaxLength = maxDumpFrame
+	rd.SkipOversize = true
+	return rd
+}
+
+type connDump struct {
+	id     int
+	opts   options
+	clock  func() string
+	offset int64
+
+	mu    sync.Mutex
+	ready *protocol.ReadyEvent
+	wavs  map[string]*wav.Writer
+}
+
+func newConnDump(id int, opts options) *connDump {
+	return &connDump{
+		id:    id,
+		opts:  opts,
+		clock: func() string { return time.Now().Format("15:04:05.000000") },
+		wavs:  make(map[string]*wav.Writer),
+	}
+}
+
+// pump forwards src to dst unchanged while decoding the frames it carries.
+// If the stream stops parsing it keeps forwarding raw bytes.
+func (d *connDump) pump(dir string, src io.Reader, dst io.Writer) {
+	rd := newDumpReader(bufio.NewReader(io.TeeReader(src, dst)))
+	for {
+		f, err := rd.ReadFrame()
+		if err != nil {
+			var tooLarge *protocol.FrameTooLargeError
+			if errors.As(err, &tooLarge) && tooLarge.Skipped {
+				d.note("%s skipped oversized frame: %v", dir, err)
+				continue
+			}
+			if err == io.EOF || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			d.note("%s decode error, forwarding raw: %v", dir, err)
+			_, _ = io.Copy(dst, src)
+			return
+		}
+		d.frame(dir, f)
+	}
+}
+
+func (d *connDump) frame(dir string, f *protocol.Frame) {
+	prefix := fmt.Sprintf("[%d] %s %s", d.id, d.clock(), dir)
+
+	switch f.Type {
+	case protocol.FrameTypeJSON:
+		t, err := protocol.ParseEventType(f.Payload)
+		if err != nil {
+			d.print("%s json  len=%d invalid: %v\n%s", prefix, f.Length, err, indent(string(f.Payload)))
+			return
+		}
+		if t == protocol.EventReady {
+			var ready protocol.ReadyEvent
+			if protocol.Decode(f.Payload, &ready) == nil {
+				d.mu.Lock()
+				d.ready = &ready
+				d.mu.Unlock()
+			}
+		}
+		d.print("%s json  len=%d %s\n%s", prefix, f.Length, t, indent(d.formatJSON(f.Payload)))
+	case protocol.FrameTypeAudio:
+		d.writeWAV(dir, f.Payload)
+		if d.opts.noAudio {
+			return
+		}
+		d.print("%s audio len=%d %s", prefix, f.Length, d.audioStats(f.Payload))
+	default:
+		d.print("%s type=0x%02x len=%d", prefix, f.Type, f.Length)
+	}
+}
+
+func (d *connDump) audioStats(pcm []byte) string {
+	d.mu.Lock()
+	ready := d.ready
+	d.mu.Unlock()
+
+	if ready == nil {
+		return "(format unknown: no ready seen)"
+	}
+	if err := ready.Validate(); err != nil {
+		return fmt.Sprintf("(no stats: %v)", err)
+	}
+	frames := len(pcm) / ready.FrameSize()
+	dur := time.Duration(frames) * time.Second / time.Duration(ready.SampleRate)
+	l, _ := audio.Measure(ready.Format, pcm)
+	return fmt.Sprintf("dur=%s rms=%.1fdBFS peak=%.1fdBFS clip=%d",
+		dur.Round(100*time.Microsecond), audio.DBFS(l.RMS), audio.DBFS(l.Peak), l.Clipped)
+}
+
+func (d *connDump) writeWAV(dir string, pcm []byte) {
+	if d.opts.wavPrefix == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, ok := d.wavs[dir]
+	if !ok {
+		if d.ready == nil {
+			return
+		}
+		path := fmt.Sprintf("%s-%d-%s.wav", d.opts.wavPrefix, d.id, strings.ReplaceAll(dir, "->", "2"))
+		h, err := wav.FromReady(*d.ready)
+		if err == nil {
+			w, err = wav.Create(path, h)
+		}
+		if err != nil {
+			log.Printf("[%d] wav: %v", d.id, err)
+			w = nil
+		}
+		d.wavs[dir] = w
+	}
+	if w != nil {
+		_, _ = w.Write(pcm)
+	}
+}
+
+func (d *connDump) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for dir, w := range d.wavs {
+		if w != nil {
+			if err := w.Close(); err != nil {
+				log.Printf("[%d] wav %s: %v", d.id, dir, err)
+			}
+		}
+	}
+}
+
+func (d *connDump) formatJSON(payload []byte) string {
+	var buf bytes.Buffer
+	var err error
+	if d.opts.compact {
+		err = json.Compact(&buf, payload)
+	} else {
+		err = json.Indent(&buf, payload, "", "  ")
+	}
+	if err != nil {
+		return string(payload)
+	}
+	return buf.String()
+}
+
+func (d *connDump) note(format string, args ...any) {
+	d.print("[%d] %s %s", d.id, d.clock(), fmt.Sprintf(format, args...))
+}
+
+func (d *connDump) print(format string, args ...any) {
+	outMu.Lock()
+	defer outMu.Unlock()
+	fmt.Printf(format+"\n", args...)
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(s, "\n", "\n    ")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"ion/protocol"
+	"ion/record"
+)
+
+func main() {
+	file := flag.String("file", "", "recording to replay")
+	addr := flag.String("addr", "", "replay the client side against the server at this address")
+	listen := flag.String("listen", "", "act as the recorded server for clients connecting here")
+	speed := flag.Float64("speed", 1, "timing scale: 1 is original, 2 is twice as fast, 0 is no delays")
+	syncTimeout := flag.Duration("sync-timeout", record.DefaultSyncTimeout, "how long to wait for each expected peer event")
+	quiet := flag.Bool("quiet", false, "do not print frames")
+	flag.Parse()
+
+	if *file == "" || (*addr == "") == (*listen == "") {
+		log.Fatal("usage: ion-replay --file REC (--addr ADDR | --listen ADDR)")
+	}
+
+	rec, err := record.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("loaded %d entries recorded by the %s", len(rec.Entries), rec.Role)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	player := &record.Player{
+		Speed:       *speed,
+		SyncTimeout: *syncTimeout,
+	}
+	if !*quiet {
+		player.OnFrame = printFrame
+	}
+
+	if *addr != "" {
+		player.As = protocol.RoleClient
+		var d net.Dialer
+		c, err := d.DialContext(ctx, "tcp", *addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer c.Close()
+		if err := player.Play(ctx, rec, c); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("replay complete")
+		return
+	}
+
+	player.As = protocol.RoleServer
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	log.Println("fake server listening on", *listen)
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Fatal(err)
+		}
+		go func() {
+			defer c.Close()
+			if err := player.Play(ctx, rec, c); err != nil {
+				log.Printf("%s: %v", c.RemoteAddr(), err)
+				return
+			}
+			log.Printf("%s: replay complete", c.RemoteAddr())
+		}()
+	}
+}
+
+var printMu sync.Mutex
+
+func printFrame(dir protocol.Direction, f *protocol.Frame) {
+	arrow := "<-"
+	if dir == protocol.Outbound {
+		arrow = "->"
+	}
+
+	printMu.Lock()
+	defer printMu.Unlock()
+	switch f.Type {
+	case protocol.FrameTypeJSON:
+		fmt.Fprintf(os.Stdout, "%s json  %s\n", arrow, f.Payload)
+	case protocol.FrameTypeAudio:
+		fmt.Fprintf(os.Stdout, "%s audio len=%d\n", arrow, len(f.Payload))
+	default:
+		fmt.Fprintf(os.Stdout, "%s type=0x%02x len=%d\n", arrow, f.Type, len(f.Payload))
+	}
+}
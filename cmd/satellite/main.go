@@ -2,245 +2,303 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"io"
 	"log"
-	"net"
 	"os"
-	"os/exec"
 	"os/signal"
-	"strings"
-	"sync"
+	"sync/atomic"
 	"syscall"
 
+	"ion/audio"
+	"ion/audio/vad"
+	"ion/client"
 	"ion/protocol"
+	"ion/record"
 )
 
-type audioSink struct {
-	cmd   *exec.Cmd
-	stdin io.WriteCloser
-	mu    sync.Mutex
-}
-
 func main() {
 	transport := flag.String("transport", "tcp", "tcp or stdio")
 	addr := flag.String("addr", ":10300", "tcp address")
 	name := flag.String("name", "ion-satellite", "satellite name")
-	micCmd := flag.String("mic-command", "", "command that outputs raw PCM on stdout")
-	sndCmd := flag.String("snd-command", "", "command that accepts raw PCM on stdin")
-	autoASR := flag.Bool("auto-asr", true, "send asr.start and stream mic immediately")
+	sourceURI := flag.String("source", "", "capture source URI (parec, arecord:DEV, pw-record, cmd:..., wav:PATH, synth:sine)")
+	micCmd := flag.String("mic-command", "", "command that outputs raw PCM on stdout (same as --source cmd:...)")
+	sinkURI := flag.String("sink", "", "playback sink URI (pacat, paplay, aplay:DEV, pw-play, cmd:..., wav:PATH, null)")
+	sndCmd := flag.String("snd-command", "", "command that accepts raw PCM on stdin (same as --sink cmd:...)")
+	autoASR := flag.Bool("auto-asr", true, "send asr.start and stream mic immediately; otherwise Enter starts and ends a turn")
+	recordPath := flag.String("record", "", "write a recording of the session to this file")
+	sampleRate := flag.Int("sample-rate", audio.DefaultSampleRate, "microphone sample rate")
+	channels := flag.Int("channels", audio.DefaultChannels, "microphone channel count")
+	format := flag.String("format", string(audio.DefaultEncoding), "microphone sample format")
+	useVAD := flag.Bool("vad", true, "detect speech in the microphone stream and send vad.start/vad.stop")
+	channelMap := flag.String("channel-map", "", "mix microphone channels before sending, e.g. 2, 1,3, mono or 0.5*1+0.5*2")
 	flag.Parse()
 
-	var (
-		reader *bufio.Reader
-		writer *bufio.Writer
-		closer io.Closer
-	)
+	if *micCmd != "" {
+		if *sourceURI != "" {
+			log.Fatal("use either --source or --mic-command")
+		}
+		*sourceURI = "cmd:" + *micCmd
+	}
+	if *sndCmd != "" {
+		if *sinkURI != "" {
+			log.Fatal("use either --sink or --snd-command")
+		}
+		*sinkURI = "cmd:" + *sndCmd
+	}
+
+	ctx := context.Background()
 
+	// The microphone is opened first so its format can be offered in
+	// describe. Sources such as wav: report their own format.
+	var src audio.Source
+	if *sourceURI != "" {
+		var err error
+		src, err = audio.OpenSource(*sourceURI, audio.Format{
+			SampleRate: *sampleRate,
+			Channels:   *channels,
+			Encoding:   protocol.SampleFormat(*format),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer src.Close()
+		if *channelMap != "" {
+			m, err := audio.ParseMatrix(*channelMap, src.Format().Channels)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if src, err = audio.MixSource(src, m); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	var c *client.Client
 	switch *transport {
 	case "tcp":
-		c, err := net.Dial("tcp", *addr)
+		var err error
+		c, err = client.Dial(ctx, *addr)
 		if err != nil {
 			log.Fatal(err)
 		}
-		reader = bufio.NewReader(c)
-		writer = bufio.NewWriter(c)
-		closer = c
 	case "stdio":
-		reader = bufio.NewReader(os.Stdin)
-		writer = bufio.NewWriter(os.Stdout)
+		c = client.New(os.Stdin, os.Stdout, nil)
 	default:
 		log.Fatalf("unknown transport: %s", *transport)
 	}
-	if closer != nil {
-		defer closer.Close()
+	defer c.Close()
+
+	c.Protocol().OnViolation = func(err error) {
+		log.Println("protocol violation:", err)
+	}
+
+	var rec *record.Writer
+	if *recordPath != "" {
+		var err error
+		rec, err = record.Create(*recordPath, protocol.RoleClient)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rec.Close()
+		c.SetTap(rec.Tap)
 	}
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	if err := sendEvent(writer, protocol.BaseEvent{Type: protocol.EventDescribe}); err != nil {
-		log.Fatal(err)
+	// Offer the microphone's own format first and the common default as a
+	// fallback; if the server picks something else we convert locally.
+	fallback := protocol.AudioFormat{SampleRate: audio.DefaultSampleRate, Channels: audio.DefaultChannels, Format: audio.DefaultEncoding}
+	mic := fallback
+	var offer []protocol.AudioFormat
+	if src != nil {
+		f := src.Format()
+		mic = protocol.AudioFormat{SampleRate: f.SampleRate, Channels: f.Channels, Format: f.Encoding}
+		offer = append(offer, mic)
+		if mic != fallback {
+			offer = append(offer, fallback)
+		}
 	}
 
-	readyFrame, err := protocol.ReadFrame(reader)
+	ready, err := c.Handshake(ctx, offer...)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if readyFrame.Type != protocol.FrameTypeJSON {
-		log.Fatalf("expected ready JSON frame, got type: %d", readyFrame.Type)
-	}
-	var ready protocol.ReadyEvent
-	if err := protocol.Decode(readyFrame.Payload, &ready); err != nil {
-		log.Fatal(err)
-	}
-	if ready.Type != protocol.EventReady {
-		log.Fatalf("expected ready event, got: %s", ready.Type)
+	readyFormat := audio.FormatOf(ready)
+
+	if src != nil && src.Format() != readyFormat {
+		log.Printf("converting microphone audio from %s to %s", src.Format(), readyFormat)
+		if src, err = audio.ConvertSource(src, readyFormat); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	if err := sendEvent(writer, protocol.SatelliteHelloEvent{
+	if err := c.Send(protocol.SatelliteHelloEvent{
 		Type:       protocol.EventSatelliteHello,
 		Name:       *name,
-		SampleRate: ready.SampleRate,
-		Channels:   ready.Channels,
-		Format:     ready.Format,
+		SampleRate: mic.SampleRate,
+		Channels:   mic.Channels,
+		Format:     mic.Format,
 		Wake:       false,
-		VAD:        false,
+		VAD:        *useVAD && src != nil,
 		ASR:        true,
 		TTS:        true,
 	}); err != nil {
 		log.Fatal(err)
 	}
 
-	sink, err := startAudioSink(*sndCmd)
-	if err != nil {
-		log.Fatal(err)
+	var sink audio.Sink
+	if *sinkURI != "" {
+		sink, err = audio.OpenSink(*sinkURI, readyFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer sink.Close()
 	}
-	defer sink.Close()
 
-	if *autoASR && *micCmd != "" {
-		if err := sendEvent(writer, protocol.ASRStartEvent{Type: protocol.EventASRStart}); err != nil {
+	// Microphone audio is only sent during an ASR turn, as the session
+	// model requires.
+	var listening atomic.Bool
+	if *autoASR && src != nil {
+		if err := c.ASRStart(""); err != nil {
 			log.Fatal(err)
 		}
+		listening.Store(true)
 	}
 
-	micDone := make(chan struct{})
-	if *micCmd != "" {
+	if !*autoASR && src != nil {
+		if *transport == "stdio" {
+			log.Println("--auto-asr=false over stdio: no way to start a turn, microphone unused")
+		} else {
+			log.Println("press Enter to start an ASR turn, Enter again to end it")
+			go pushToTalk(c, &listening)
+		}
+	}
+
+	if src != nil {
+		var detector *vad.Stream
+		if *useVAD {
+			if detector, err = vad.NewStream(src.Format(), vad.Config{}); err != nil {
+				log.Fatal(err)
+			}
+		}
 		go func() {
-			if err := streamMic(*micCmd, writer); err != nil {
+			if err := streamMic(src, c, detector, &listening); err != nil {
 				log.Println("mic stream error:", err)
 			}
-			close(micDone)
 		}()
 	}
 
 	go func() {
 		<-interrupt
-		if *autoASR && *micCmd != "" {
-			_ = sendEvent(writer, protocol.ASRStopEvent{Type: protocol.EventASRStop})
+		if listening.Swap(false) {
+			_ = c.ASRStop()
+		}
+		if src != nil {
+			_ = src.Close()
 		}
 		if sink != nil {
 			_ = sink.Close()
 		}
+		if rec != nil {
+			_ = rec.Close()
+		}
 		os.Exit(0)
 	}()
 
-	for {
-		f, err := protocol.ReadFrame(reader)
-		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				return
-			}
-			log.Fatal(err)
-		}
-		switch f.Type {
-		case protocol.FrameTypeJSON:
-			log.Printf("event: %s", string(f.Payload))
-		case protocol.FrameTypeAudio:
-			if sink != nil {
-				_ = sink.Write(f.Payload)
-			}
-		default:
-			// ignore
-		}
+	if sink != nil {
+		go func() {
+			_, _ = io.Copy(sink, c.Audio())
+		}()
 	}
-}
 
-func sendEvent(w *bufio.Writer, ev any) error {
-	payload, err := protocol.Encode(ev)
-	if err != nil {
-		return err
-	}
-	frame := &protocol.Frame{
-		Version: protocol.VersionByte,
-		Type:    protocol.FrameTypeJSON,
-		Length:  uint32(len(payload)),
-		Payload: payload,
+	for ev := range c.Events() {
+		payload, _ := protocol.Encode(ev)
+		log.Printf("event: %s", string(payload))
+		// The server may end a turn on its own when it hears the
+		// utterance end; keep listening for the next one.
+		switch ev.EventType() {
+		case protocol.EventASRResult, protocol.EventASRError:
+			listening.Store(false)
+			if *autoASR && src != nil {
+				if err := c.ASRStart(""); err != nil {
+					log.Println("asr restart:", err)
+					break
+				}
+				listening.Store(true)
+			}
+		}
 	}
-	if err := protocol.WriteFrame(w, frame); err != nil {
-		return err
+	if err := c.Err(); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		log.Fatal(err)
 	}
-	return w.Flush()
 }
 
-func streamMic(cmdLine string, w *bufio.Writer) error {
-	cmd := exec.Command("sh", "-c", cmdLine)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	cmd.Stderr = os.Stderr
-	if err := cmd.Start(); err != nil {
-		return err
+// pushToTalk toggles an ASR turn on each line read from stdin. The server
+// may also end a turn itself, after which the next line starts a new one.
+func pushToTalk(c *client.Client, listening *atomic.Bool) {
+	lines := bufio.NewScanner(os.Stdin)
+	for lines.Scan() {
+		if listening.Swap(false) {
+			if err := c.ASRStop(); err != nil {
+				log.Println("asr stop:", err)
+			}
+			continue
+		}
+		if err := c.ASRStart(""); err != nil {
+			log.Println("asr start:", err)
+			continue
+		}
+		listening.Store(true)
 	}
-	defer func() {
-		_ = cmd.Process.Kill()
-	}()
+}
 
-	buf := make([]byte, 320*2)
+// streamMic sends the microphone in 20 ms chunks while listening is set,
+// reporting voice activity if detector is set.
+func streamMic(src audio.Source, c *client.Client, detector *vad.Stream, listening *atomic.Bool) error {
+	format := src.Format()
+	buf := make([]byte, format.SampleRate/50*format.FrameSize())
+	var events []vad.Event
 	for {
-		n, err := stdout.Read(buf)
+		n, err := src.Read(buf)
 		if n > 0 {
-			frame := &protocol.Frame{
-				Version: protocol.VersionByte,
-				Type:    protocol.FrameTypeAudio,
-				Length:  uint32(n),
-				Payload: buf[:n],
-			}
-			if err := protocol.WriteFrame(w, frame); err != nil {
-				return err
+			if listening.Load() {
+				if err := c.SendAudio(buf[:n]); err != nil {
+					return err
+				}
 			}
-			if err := w.Flush(); err != nil {
-				return err
+			if detector != nil {
+				var verr error
+				if events, verr = detector.Write(events[:0], buf[:n]); verr != nil {
+					return verr
+				}
+				for _, ev := range events {
+					if err := sendVAD(c, ev); err != nil {
+						return err
+					}
+				}
 			}
 		}
 		if err != nil {
-			if err == io.EOF {
-				return nil
+			if err != io.EOF {
+				return err
 			}
-			return err
+			if detector != nil && detector.Speaking() {
+				return c.Send(protocol.VADStopEvent{Type: protocol.EventVADStop})
+			}
+			return nil
 		}
 	}
 }
 
-func startAudioSink(cmdLine string) (*audioSink, error) {
-	if strings.TrimSpace(cmdLine) == "" {
-		return nil, nil
-	}
-	cmd := exec.Command("sh", "-c", cmdLine)
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, err
-	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Start(); err != nil {
-		return nil, err
-	}
-	return &audioSink{cmd: cmd, stdin: stdin}, nil
-}
-
-func (s *audioSink) Write(p []byte) error {
-	if s == nil {
-		return nil
-	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	_, err := s.stdin.Write(p)
-	return err
-}
-
-func (s *audioSink) Close() error {
-	if s == nil {
-		return nil
-	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.stdin != nil {
-		_ = s.stdin.Close()
-	}
-	if s.cmd != nil && s.cmd.Process != nil {
-		_ = s.cmd.Process.Kill()
+func sendVAD(c *client.Client, ev vad.Event) error {
+	switch ev.Kind {
+	case vad.Start:
+		return c.Send(protocol.VADStartEvent{Type: protocol.EventVADStart})
+	case vad.Stop:
+		return c.Send(protocol.VADStopEvent{Type: protocol.EventVADStop})
 	}
 	return nil
 }
@@ -0,0 +1,140 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ion/protocol"
+)
+
+const observeWindow = 3 * time.Second
+
+// ClientScenarios check an implementation that connects to a server, such
+// as a satellite. Each scenario consumes one incoming connection.
+func ClientScenarios() []Scenario {
+	return []Scenario{
+		{
+			Name:        "describe-first",
+			Profile:     ProfileCore,
+			Description: "the first frame is a version 1 describe event",
+			Run: func(ctx context.Context, c *Conn) error {
+				f, err := c.ReadFrame(ioTimeout)
+				if err != nil {
+					return err
+				}
+				if f.Type != protocol.FrameTypeJSON {
+					return fmt.Errorf("first frame has type 0x%02x, want JSON", f.Type)
+				}
+				t, err := protocol.ParseEventType(f.Payload)
+				if err != nil {
+					return err
+				}
+				if t != protocol.EventDescribe {
+					return fmt.Errorf("first event is %q, want describe", t)
+				}
+				return c.sendReady()
+			},
+		},
+		{
+			Name:        "session-model",
+			Profile:     ProfileCore,
+			Description: "frames sent after ready follow the session model",
+			Run: func(ctx context.Context, c *Conn) error {
+				if err := c.acceptHandshake(); err != nil {
+					return err
+				}
+				proto := protocol.NewSession(protocol.RoleServer)
+				proto.Strict = true
+				_ = proto.ObserveEvent(protocol.Inbound, protocol.EventDescribe)
+				_ = proto.ObserveEvent(protocol.Outbound, protocol.EventReady)
+
+				deadline := time.Now().Add(observeWindow)
+				for {
+					f, err := c.ReadFrame(time.Until(deadline))
+					if err != nil {
+						if isTimeout(err) || errors.Is(err, errPeerClosed) {
+							return nil
+						}
+						return err
+					}
+					if err := proto.ObserveFrame(protocol.Inbound, f); err != nil {
+						return err
+					}
+				}
+			},
+		},
+		{
+			Name:        "unknown-event",
+			Profile:     ProfileCore,
+			Description: "unknown events from the server are ignored",
+			Run: func(ctx context.Context, c *Conn) error {
+				if err := c.acceptHandshake(); err != nil {
+					return err
+				}
+				if err := c.Send(protocol.BaseEvent{Type: "conformance.unknown"}); err != nil {
+					return err
+				}
+				return c.expectQuiet(quietWindow)
+			},
+		},
+		{
+			Name:        "bad-version",
+			Profile:     ProfileCore,
+			Description: "a frame with an unknown version is rejected",
+			Run: func(ctx context.Context, c *Conn) error {
+				if err := c.acceptHandshake(); err != nil {
+					return err
+				}
+				payload := []byte(`{"type":"conformance.unknown"}`)
+				if err := c.SendRaw(rawFrame(0x7f, protocol.FrameTypeJSON, uint32(len(payload)), payload)); err != nil {
+					return err
+				}
+				return c.expectRejection(rejectTimeout)
+			},
+		},
+		{
+			Name:        "satellite-hello",
+			Profile:     ProfileSatellite,
+			Description: "satellite.hello follows ready and describes the microphone",
+			Run: func(ctx context.Context, c *Conn) error {
+				if err := c.acceptHandshake(); err != nil {
+					return err
+				}
+				ev, err := c.Expect(ioTimeout, protocol.EventSatelliteHello)
+				if err != nil {
+					return err
+				}
+				hello := ev.(protocol.SatelliteHelloEvent)
+				switch {
+				case hello.Name == "":
+					return errors.New("satellite.hello without name")
+				case hello.SampleRate <= 0 || hello.Channels <= 0 || !hello.Format.Valid():
+					return fmt.Errorf("satellite.hello with incomplete format: %d Hz, %d ch, %q", hello.SampleRate, hello.Channels, hello.Format)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+var defaultReady = protocol.ReadyEvent{
+	Type:       protocol.EventReady,
+	Protocol:   "ion",
+	SampleRate: 16000,
+	Channels:   1,
+	Format:     protocol.FormatS16LE,
+}
+
+func (c *Conn) sendReady() error {
+	c.Ready = defaultReady
+	return c.Send(defaultReady)
+}
+
+func (c *Conn) acceptHandshake() error {
+	if _, err := c.Expect(ioTimeout, protocol.EventDescribe); err != nil {
+		return err
+	}
+	return c.sendReady()
+}
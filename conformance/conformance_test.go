@@ -0,0 +1,28 @@
+package conformance
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+
+	"ion/protocol"
+	"ion/server"
+)
+
+func TestReferenceServerCore(t *testing.T) {
+	srv := server.New()
+	srv.ErrorLog = log.New(io.Discard, "", 0)
+	srv.Handle(protocol.EventDescribe, func(s *server.Session, ev protocol.Event) error {
+		_, err := s.Negotiate(ev.(protocol.DescribeEvent), defaultReady.AudioFormat())
+		return err
+	})
+
+	connect := func(ctx context.Context) (net.Conn, error) {
+		c, sc := net.Pipe()
+		go srv.ServeConn(ctx, sc)
+		return c, nil
+	}
+	TestServer(t, connect, Select(ServerScenarios(), ProfileCore, ProfileSatellite)...)
+}
@@ -0,0 +1,182 @@
+package conformance
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"ion/protocol"
+)
+
+const ioTimeout = 5 * time.Second
+
+var errPeerClosed = errors.New("peer closed the connection")
+
+// PeerError is returned when the peer answers with an error event.
+type PeerError struct {
+	Message string
+}
+
+func (e *PeerError) Error() string {
+	return "peer sent error: " + e.Message
+}
+
+// Conn is the scenario side of a connection under test. Every read and
+// write is bounded by a deadline so a stuck peer fails instead of hanging.
+type Conn struct {
+	c     net.Conn
+	r     *protocol.Reader
+	Ready protocol.ReadyEvent
+}
+
+func NewConn(c net.Conn) *Conn {
+	return &Conn{c: c, r: protocol.NewReader(bufio.NewReader(c))}
+}
+
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
+
+func (c *Conn) Send(ev protocol.Event) error {
+	_ = c.c.SetWriteDeadline(time.Now().Add(ioTimeout))
+	return protocol.WriteJSON(c.c, ev)
+}
+
+func (c *Conn) SendAudio(pcm []byte) error {
+	_ = c.c.SetWriteDeadline(time.Now().Add(ioTimeout))
+	return protocol.WriteAudio(c.c, pcm)
+}
+
+// SendRaw writes bytes verbatim, for frames a well-behaved encoder would
+// never produce.
+func (c *Conn) SendRaw(b []byte) error {
+	_ = c.c.SetWriteDeadline(time.Now().Add(ioTimeout))
+	_, err := c.c.Write(b)
+	return err
+}
+
+func (c *Conn) ReadFrame(timeout time.Duration) (*protocol.Frame, error) {
+	_ = c.c.SetReadDeadline(time.Now().Add(timeout))
+	f, err := c.r.ReadFrame()
+	if err != nil && isClosed(err) {
+		return nil, errPeerClosed
+	}
+	return f, err
+}
+
+// ReadEvent returns the next JSON event, skipping audio frames.
+func (c *Conn) ReadEvent(timeout time.Duration) (protocol.Event, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := c.ReadFrame(time.Until(deadline))
+		if err != nil {
+			return nil, err
+		}
+		if f.Type == protocol.FrameTypeJSON {
+			return protocol.DecodeEvent(f.Payload)
+		}
+	}
+}
+
+// Expect reads until one of the given event types arrives. An error event
+// from the peer ends the wait early.
+func (c *Conn) Expect(timeout time.Duration, types ...protocol.EventType) (protocol.Event, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		ev, err := c.ReadEvent(time.Until(deadline))
+		if err != nil {
+			if isTimeout(err) {
+				return nil, fmt.Errorf("timed out waiting for %v", types)
+			}
+			return nil, err
+		}
+		for _, t := range types {
+			if ev.EventType() == t {
+				return ev, nil
+			}
+		}
+		if e, ok := ev.(protocol.ErrorEvent); ok {
+			return nil, &PeerError{Message: e.Message}
+		}
+	}
+}
+
+func (c *Conn) Handshake() (protocol.ReadyEvent, error) {
+	if err := c.Send(protocol.DescribeEvent{Type: protocol.EventDescribe}); err != nil {
+		return protocol.ReadyEvent{}, err
+	}
+	ev, err := c.Expect(ioTimeout, protocol.EventReady)
+	if err != nil {
+		return protocol.ReadyEvent{}, err
+	}
+	c.Ready = ev.(protocol.ReadyEvent)
+	return c.Ready, nil
+}
+
+// expectRejection passes if the peer answers with an error event or closes
+// the connection before the timeout.
+func (c *Conn) expectRejection(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := c.ReadFrame(time.Until(deadline))
+		if err != nil {
+			if isTimeout(err) {
+				return errors.New("peer neither sent error nor closed the connection")
+			}
+			return nil
+		}
+		if f.Type != protocol.FrameTypeJSON {
+			continue
+		}
+		if t, err := protocol.ParseEventType(f.Payload); err == nil && t == protocol.EventError {
+			return nil
+		}
+	}
+}
+
+// expectQuiet passes if the peer sends no error event and keeps the
+// connection open for the whole window.
+func (c *Conn) expectQuiet(window time.Duration) error {
+	deadline := time.Now().Add(window)
+	for {
+		f, err := c.ReadFrame(time.Until(deadline))
+		if err != nil {
+			if isTimeout(err) {
+				return nil
+			}
+			return err
+		}
+		if f.Type != protocol.FrameTypeJSON {
+			continue
+		}
+		ev, err := protocol.DecodeEvent(f.Payload)
+		if err != nil {
+			return err
+		}
+		if e, ok := ev.(protocol.ErrorEvent); ok {
+			return &PeerError{Message: e.Message}
+		}
+	}
+}
+
+func rawFrame(version, frameType byte, length uint32, payload []byte) []byte {
+	b := []byte{version, frameType, byte(length), byte(length >> 8), byte(length >> 16), byte(length >> 24)}
+	return append(b, payload...)
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func isClosed(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
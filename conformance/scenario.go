@@ -0,0 +1,169 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	ProfileCore      = "core"
+	ProfileASR       = "asr"
+	ProfileTTS       = "tts"
+	ProfileSatellite = "satellite"
+)
+
+type Scenario struct {
+	Name        string
+	Profile     string
+	Description string
+	Run         func(ctx context.Context, c *Conn) error
+}
+
+func (s Scenario) ID() string {
+	return s.Profile + "/" + s.Name
+}
+
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+// Skip marks a scenario as not applicable, for example when the peer does
+// not implement the profile under test.
+func Skip(format string, args ...any) error {
+	return &skipError{reason: fmt.Sprintf(format, args...)}
+}
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+type Result struct {
+	Scenario string        `json:"scenario"`
+	Profile  string        `json:"profile"`
+	Status   Status        `json:"status"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+type Report struct {
+	Target  string    `json:"target"`
+	Role    string    `json:"role"`
+	Started time.Time `json:"started"`
+	Results []Result  `json:"results"`
+	Passed  int       `json:"passed"`
+	Failed  int       `json:"failed"`
+	Skipped int       `json:"skipped"`
+}
+
+func (r *Report) OK() bool {
+	return r.Failed == 0
+}
+
+func (r *Report) add(res Result) {
+	r.Results = append(r.Results, res)
+	switch res.Status {
+	case StatusPass:
+		r.Passed++
+	case StatusFail:
+		r.Failed++
+	case StatusSkip:
+		r.Skipped++
+	}
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "ION conformance: %s %s\n", r.Role, r.Target); err != nil {
+		return err
+	}
+	for _, res := range r.Results {
+		line := fmt.Sprintf("%-5s %-32s %8s", strings.ToUpper(string(res.Status)), res.Profile+"/"+res.Scenario, res.Duration.Round(time.Millisecond))
+		if res.Message != "" {
+			line += "  " + res.Message
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d passed, %d failed, %d skipped\n", r.Passed, r.Failed, r.Skipped)
+	return err
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Select keeps the scenarios belonging to any of the given profiles.
+func Select(scenarios []Scenario, profiles ...string) []Scenario {
+	if len(profiles) == 0 {
+		return scenarios
+	}
+	var out []Scenario
+	for _, s := range scenarios {
+		for _, p := range profiles {
+			if s.Profile == p {
+				out = append(out, s)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Connect opens one connection per scenario. For server testing it dials
+// the implementation; for client testing it accepts the next connection.
+type Connect func(ctx context.Context) (net.Conn, error)
+
+func Run(ctx context.Context, role, target string, connect Connect, scenarios []Scenario) *Report {
+	report := &Report{Target: target, Role: role, Started: time.Now()}
+	for _, s := range scenarios {
+		report.add(RunScenario(ctx, connect, s))
+	}
+	return report
+}
+
+func RunScenario(ctx context.Context, connect Connect, s Scenario) Result {
+	res := Result{Scenario: s.Name, Profile: s.Profile}
+	start := time.Now()
+
+	nc, err := connect(ctx)
+	if err != nil {
+		res.Status = StatusFail
+		res.Message = "connect: " + err.Error()
+		res.Duration = time.Since(start)
+		return res
+	}
+	c := NewConn(nc)
+	defer c.Close()
+
+	err = s.Run(ctx, c)
+	res.Duration = time.Since(start)
+
+	var skip *skipError
+	switch {
+	case err == nil:
+		res.Status = StatusPass
+	case errors.As(err, &skip):
+		res.Status = StatusSkip
+		res.Message = skip.reason
+	default:
+		res.Status = StatusFail
+		res.Message = err.Error()
+	}
+	return res
+}
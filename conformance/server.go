@@ -0,0 +1,415 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ion/protocol"
+)
+
+const (
+	rejectTimeout = 2 * time.Second
+	quietWindow   = 500 * time.Millisecond
+	resultTimeout = 15 * time.Second
+	stopGrace     = 250 * time.Millisecond
+)
+
+// ServerScenarios check an implementation that accepts connections and
+// plays the server role.
+func ServerScenarios() []Scenario {
+	return []Scenario{
+		{
+			Name:        "handshake",
+			Profile:     ProfileCore,
+			Description: "describe is answered with a well-formed ready",
+			Run:         serverHandshake,
+		},
+		{
+			Name:        "negotiate",
+			Profile:     ProfileCore,
+			Description: "ready uses a format offered in describe, or the server sends error",
+			Run: func(ctx context.Context, c *Conn) error {
+				offer := protocol.AudioFormat{SampleRate: 8000, Channels: 1, Format: protocol.FormatAlaw}
+				if err := c.Send(protocol.DescribeEvent{
+					Type:      protocol.EventDescribe,
+					Formats:   []protocol.AudioFormat{offer},
+					Preferred: &offer,
+				}); err != nil {
+					return err
+				}
+				ev, err := c.Expect(ioTimeout, protocol.EventReady)
+				var perr *PeerError
+				if errors.As(err, &perr) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if got := ev.(protocol.ReadyEvent).AudioFormat(); got != offer {
+					return fmt.Errorf("ready announced %v but only %v was offered", got, offer)
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "bad-version",
+			Profile:     ProfileCore,
+			Description: "a frame with an unknown version is rejected",
+			Run: func(ctx context.Context, c *Conn) error {
+				payload := []byte(`{"type":"describe"}`)
+				if err := c.SendRaw(rawFrame(0x7f, protocol.FrameTypeJSON, uint32(len(payload)), payload)); err != nil {
+					return err
+				}
+				return c.expectRejection(rejectTimeout)
+			},
+		},
+		{
+			Name:        "oversized-frame",
+			Profile:     ProfileCore,
+			Description: "a JSON frame announcing ~4 GiB is rejected without waiting for the payload",
+			Run: func(ctx context.Context, c *Conn) error {
+				if err := c.SendRaw(rawFrame(protocol.VersionByte, protocol.FrameTypeJSON, 0xFFFFFFF0, nil)); err != nil {
+					return err
+				}
+				return c.expectRejection(rejectTimeout)
+			},
+		},
+		{
+			Name:        "malformed-json",
+			Profile:     ProfileCore,
+			Description: "a JSON frame that does not parse is rejected",
+			Run: func(ctx context.Context, c *Conn) error {
+				payload := []byte(`{"type":`)
+				if err := c.SendRaw(rawFrame(protocol.VersionByte, protocol.FrameTypeJSON, uint32(len(payload)), payload)); err != nil {
+					return err
+				}
+				return c.expectRejection(rejectTimeout)
+			},
+		},
+		{
+			Name:        "missing-type",
+			Profile:     ProfileCore,
+			Description: "a JSON event without type is rejected",
+			Run: func(ctx context.Context, c *Conn) error {
+				payload := []byte(`{"sample_rate":16000}`)
+				if err := c.SendRaw(rawFrame(protocol.VersionByte, protocol.FrameTypeJSON, uint32(len(payload)), payload)); err != nil {
+					return err
+				}
+				return c.expectRejection(rejectTimeout)
+			},
+		},
+		{
+			Name:        "unknown-event",
+			Profile:     ProfileCore,
+			Description: "unknown events are ignored",
+			Run: func(ctx context.Context, c *Conn) error {
+				if _, err := c.Handshake(); err != nil {
+					return err
+				}
+				if err := c.Send(protocol.BaseEvent{Type: "conformance.unknown"}); err != nil {
+					return err
+				}
+				if err := c.expectQuiet(quietWindow); err != nil {
+					return err
+				}
+				_, err := c.Handshake()
+				return err
+			},
+		},
+		{
+			Name:        "unknown-frame-type",
+			Profile:     ProfileCore,
+			Description: "frames of an unknown type are ignored",
+			Run: func(ctx context.Context, c *Conn) error {
+				if _, err := c.Handshake(); err != nil {
+					return err
+				}
+				if err := c.SendRaw(rawFrame(protocol.VersionByte, 0x7e, 4, []byte{1, 2, 3, 4})); err != nil {
+					return err
+				}
+				_, err := c.Handshake()
+				return err
+			},
+		},
+		{
+			Name:        "audio-before-start",
+			Profile:     ProfileCore,
+			Description: "audio sent after ready but before start does not break the session",
+			Run: func(ctx context.Context, c *Conn) error {
+				ready, err := c.Handshake()
+				if err != nil {
+					return err
+				}
+				chunk, err := silence(ready, 20*time.Millisecond)
+				if err != nil {
+					return err
+				}
+				if err := c.SendAudio(chunk); err != nil {
+					return err
+				}
+				// The server may answer the stray audio with an error event,
+				// but must still serve the next request.
+				if err := c.Send(protocol.DescribeEvent{Type: protocol.EventDescribe}); err != nil {
+					return err
+				}
+				for {
+					ev, err := c.ReadEvent(ioTimeout)
+					if err != nil {
+						return fmt.Errorf("no ready after stray audio: %w", err)
+					}
+					if ev.EventType() == protocol.EventReady {
+						return nil
+					}
+				}
+			},
+		},
+		{
+			Name:        "asr-flow",
+			Profile:     ProfileASR,
+			Description: "asr.start, one second of audio and asr.stop produce asr.result",
+			Run: func(ctx context.Context, c *Conn) error {
+				ready, err := c.Handshake()
+				if err != nil {
+					return err
+				}
+				chunk, err := silence(ready, 20*time.Millisecond)
+				if err != nil {
+					return err
+				}
+				if err := c.Send(protocol.ASRStartEvent{Type: protocol.EventASRStart}); err != nil {
+					return err
+				}
+				for i := 0; i < 50; i++ {
+					if err := c.SendAudio(chunk); err != nil {
+						return err
+					}
+				}
+				if err := c.Send(protocol.ASRStopEvent{Type: protocol.EventASRStop}); err != nil {
+					return err
+				}
+				_, err = c.Expect(resultTimeout, protocol.EventASRResult, protocol.EventASRError)
+				return notSupported(err, "asr")
+			},
+		},
+		{
+			Name:        "tts-flow",
+			Profile:     ProfileTTS,
+			Description: "tts.start produces tts.ready, audio and tts.done",
+			Run: func(ctx context.Context, c *Conn) error {
+				if _, err := c.Handshake(); err != nil {
+					return err
+				}
+				if err := c.Send(protocol.TTSStartEvent{Type: protocol.EventTTSStart, Text: "conformance test"}); err != nil {
+					return err
+				}
+				if _, err := c.Expect(resultTimeout, protocol.EventTTSReady); err != nil {
+					return notSupported(err, "tts")
+				}
+				return awaitTTSDone(c, resultTimeout)
+			},
+		},
+		{
+			Name:        "tts-stream",
+			Profile:     ProfileTTS,
+			Description: "text streamed in tts.chunk events produces tts.ready, audio and tts.done",
+			Run: func(ctx context.Context, c *Conn) error {
+				if _, err := c.Handshake(); err != nil {
+					return err
+				}
+				if err := c.Send(protocol.TTSStartEvent{Type: protocol.EventTTSStart, Text: "This is a str", Stream: true}); err != nil {
+					return err
+				}
+				for _, text := range []string{"eamed conformance", " test. And a second", " sentence."} {
+					if err := c.Send(protocol.TTSChunkEvent{Type: protocol.EventTTSChunk, Text: text}); err != nil {
+						return err
+					}
+				}
+				if err := c.Send(protocol.TTSEndEvent{Type: protocol.EventTTSEnd}); err != nil {
+					return err
+				}
+				if _, err := c.Expect(resultTimeout, protocol.EventTTSReady); err != nil {
+					return notSupported(err, "tts streaming")
+				}
+				return awaitTTSDone(c, resultTimeout)
+			},
+		},
+		{
+			Name:        "tts-stop-mid-stream",
+			Profile:     ProfileTTS,
+			Description: "no audio follows tts.stop once in-flight frames have drained",
+			Run: func(ctx context.Context, c *Conn) error {
+				if _, err := c.Handshake(); err != nil {
+					return err
+				}
+				text := "This sentence is long enough that synthesis is still running when the stop request arrives."
+				if err := c.Send(protocol.TTSStartEvent{Type: protocol.EventTTSStart, Text: text}); err != nil {
+					return err
+				}
+				if _, err := c.Expect(resultTimeout, protocol.EventTTSReady); err != nil {
+					return notSupported(err, "tts")
+				}
+				if err := awaitAudio(c, resultTimeout); err != nil {
+					return err
+				}
+				if err := c.Send(protocol.TTSStopEvent{Type: protocol.EventTTSStop}); err != nil {
+					return err
+				}
+				stopped := time.Now()
+				deadline := stopped.Add(stopGrace + quietWindow)
+				for {
+					f, err := c.ReadFrame(time.Until(deadline))
+					if err != nil {
+						if isTimeout(err) {
+							return nil
+						}
+						return err
+					}
+					if f.Type == protocol.FrameTypeAudio && time.Since(stopped) > stopGrace {
+						return fmt.Errorf("audio %s after tts.stop", time.Since(stopped).Round(time.Millisecond))
+					}
+				}
+			},
+		},
+		{
+			Name:        "tts-voices",
+			Profile:     ProfileTTS,
+			Description: "tts.voices is answered and tts.start with an unlisted voice fails",
+			Run: func(ctx context.Context, c *Conn) error {
+				if _, err := c.Handshake(); err != nil {
+					return err
+				}
+				if err := c.Send(protocol.TTSVoicesEvent{Type: protocol.EventTTSVoices}); err != nil {
+					return err
+				}
+				ev, err := c.Expect(resultTimeout, protocol.EventTTSVoicesResult)
+				if err != nil {
+					if errors.Is(err, errPeerClosed) {
+						return err
+					}
+					// tts.voices is optional: both an error and silence mean
+					// the server does not list voices.
+					return Skip("tts.voices not supported: %v", err)
+				}
+				voices := ev.(protocol.TTSVoicesResultEvent).Voices
+				seen := map[string]bool{}
+				for _, v := range voices {
+					if v.ID == "" || seen[v.ID] {
+						return fmt.Errorf("voice id %q empty or repeated", v.ID)
+					}
+					seen[v.ID] = true
+				}
+				if len(voices) == 0 {
+					return nil
+				}
+				err = c.Send(protocol.TTSStartEvent{Type: protocol.EventTTSStart, Text: "conformance test", Voice: "ion-conformance-no-such-voice"})
+				if err != nil {
+					return err
+				}
+				ev, err = c.Expect(resultTimeout, protocol.EventTTSError, protocol.EventTTSReady)
+				if err != nil {
+					return err
+				}
+				if ev.EventType() == protocol.EventTTSReady {
+					return errors.New("tts.start with an unlisted voice was accepted")
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "satellite-hello",
+			Profile:     ProfileSatellite,
+			Description: "satellite.hello after ready is accepted",
+			Run: func(ctx context.Context, c *Conn) error {
+				ready, err := c.Handshake()
+				if err != nil {
+					return err
+				}
+				err = c.Send(protocol.SatelliteHelloEvent{
+					Type:       protocol.EventSatelliteHello,
+					Name:       "ion-conformance",
+					SampleRate: ready.SampleRate,
+					Channels:   ready.Channels,
+					Format:     ready.Format,
+					ASR:        true,
+					TTS:        true,
+				})
+				if err != nil {
+					return err
+				}
+				return c.expectQuiet(quietWindow)
+			},
+		},
+	}
+}
+
+func serverHandshake(ctx context.Context, c *Conn) error {
+	ready, err := c.Handshake()
+	if err != nil {
+		return err
+	}
+	switch {
+	case ready.Protocol != "ion":
+		return fmt.Errorf("ready.protocol = %q, want \"ion\"", ready.Protocol)
+	}
+	return ready.Validate()
+}
+
+func awaitAudio(c *Conn, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := c.ReadFrame(time.Until(deadline))
+		if err != nil {
+			return fmt.Errorf("waiting for audio: %w", err)
+		}
+		if f.Type == protocol.FrameTypeAudio {
+			return nil
+		}
+	}
+}
+
+// awaitTTSDone reads until tts.done, which must follow some audio.
+func awaitTTSDone(c *Conn, timeout time.Duration) error {
+	audio := 0
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := c.ReadFrame(time.Until(deadline))
+		if err != nil {
+			return fmt.Errorf("waiting for tts.done: %w", err)
+		}
+		if f.Type == protocol.FrameTypeAudio {
+			audio++
+			continue
+		}
+		if t, _ := protocol.ParseEventType(f.Payload); t == protocol.EventTTSDone {
+			break
+		}
+	}
+	if audio == 0 {
+		return errors.New("tts.done without any audio")
+	}
+	return nil
+}
+
+func silence(ready protocol.ReadyEvent, d time.Duration) ([]byte, error) {
+	frames := int(time.Duration(ready.SampleRate) * d / time.Second)
+	pcm, err := protocol.EncodeSamples(nil, ready.Format, make([]float32, frames*ready.Channels))
+	if err != nil {
+		return nil, Skip("format %q not supported by the scenario", ready.Format)
+	}
+	return pcm, nil
+}
+
+// notSupported turns an error reply into a skip: the peer is allowed to
+// not implement an optional profile.
+func notSupported(err error, profile string) error {
+	if err == nil {
+		return nil
+	}
+	var perr *PeerError
+	if errors.As(err, &perr) {
+		return Skip("%s not supported: %s", profile, perr.Message)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+)
+
+// TestServer runs scenarios against a server implementation as subtests.
+// With no scenarios given, every server scenario is run.
+func TestServer(t *testing.T, connect Connect, scenarios ...Scenario) {
+	t.Helper()
+	if len(scenarios) == 0 {
+		scenarios = ServerScenarios()
+	}
+	runTests(t, connect, scenarios)
+}
+
+// TestClient runs scenarios against a client implementation; connect must
+// return the next connection the client makes.
+func TestClient(t *testing.T, connect Connect, scenarios ...Scenario) {
+	t.Helper()
+	if len(scenarios) == 0 {
+		scenarios = ClientScenarios()
+	}
+	runTests(t, connect, scenarios)
+}
+
+func runTests(t *testing.T, connect Connect, scenarios []Scenario) {
+	for _, s := range scenarios {
+		t.Run(s.ID(), func(t *testing.T) {
+			res := RunScenario(context.Background(), connect, s)
+			switch res.Status {
+			case StatusSkip:
+				t.Skip(res.Message)
+			case StatusFail:
+				t.Fatal(res.Message)
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -11,28 +11,35 @@ import (
 	"sync"
 
 	"ion/audio"
+	"ion/client"
 	"ion/protocol"
+	"ion/server"
 )
 
 const (
 	defaultSampleRate = 16000
 	defaultChannels   = 1
-	defaultFormat     = "s16le"
+	defaultFormat     = protocol.FormatS16LE
 	defaultAddr       = ":10300"
 )
 
+var (
+	sourceURI          string
+	defaultAudioFormat = protocol.AudioFormat{SampleRate: defaultSampleRate, Channels: defaultChannels, Format: defaultFormat}
+)
+
 type connState struct {
-	out      *bufio.Writer
-	outMu    sync.Mutex
-	capture  *audio.PipewireCapture
+	sess     *server.Session
 	streamMu sync.Mutex
 	streamOn bool
+	capture  audio.Source
 }
 
 func main() {
 	mode := flag.String("mode", "server", "server or client")
 	transport := flag.String("transport", "tcp", "tcp or stdio")
 	addr := flag.String("addr", defaultAddr, "tcp listen/connect address")
+	flag.StringVar(&sourceURI, "source", "parec", "capture source URI (parec, arecord:DEV, pw-record, cmd:..., wav:PATH, synth:sine)")
 	flag.Parse()
 
 	switch *mode {
@@ -46,109 +53,50 @@ func main() {
 }
 
 func runServer(transport, addr string) {
+	srv := newServer()
+	ctx := context.Background()
+
 	switch transport {
 	case "stdio":
-		handleConn(os.Stdin, os.Stdout)
+		_ = srv.ServeStream(ctx, os.Stdin, os.Stdout)
 	case "tcp":
 		ln, err := net.Listen("tcp", addr)
 		if err != nil {
 			log.Fatal(err)
 		}
 		log.Println("listening on", addr)
-		for {
-			c, err := ln.Accept()
-			if err != nil {
-				continue
-			}
-			go handleTCPConn(c)
-		}
+		log.Fatal(srv.Serve(ctx, ln))
 	default:
 		log.Fatalf("unknown transport: %s", transport)
 	}
 }
 
-func handleTCPConn(c net.Conn) {
-	defer c.Close()
-	handleConn(c, c)
-}
-
-func handleConn(in io.Reader, out io.Writer) {
-	reader := bufio.NewReader(in)
-	writer := bufio.NewWriter(out)
-	state := &connState{out: writer}
-
-	for {
-		f, err := protocol.ReadFrame(reader)
-		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				return
-			}
-			log.Println("read frame:", err)
-			return
-		}
-
-		switch f.Type {
-		case protocol.FrameTypeJSON:
-			if err := handleJSON(state, f.Payload); err != nil {
-				log.Println("handleJSON:", err)
-				return
-			}
-		case protocol.FrameTypeAudio:
-			// This node is a source; ignore incoming audio for now.
-		default:
-			// Ignore unknown frame types.
-		}
+func newServer() *server.Server {
+	srv := server.New()
+	srv.OnConnect = func(s *server.Session) {
+		s.SetValue(&connState{sess: s})
 	}
-}
-
-func handleJSON(state *connState, payload []byte) error {
-	var base protocol.BaseEvent
-	if err := protocol.Decode(payload, &base); err != nil {
-		return err
+	srv.OnDisconnect = func(s *server.Session) {
+		_ = stopStreaming(stateOf(s))
 	}
-
-	switch base.Type {
-	case protocol.EventDescribe:
-		return sendReady(state)
-	case protocol.EventStart:
-		return startStreaming(state)
-	case protocol.EventStop:
-		return stopStreaming(state)
-	default:
-		return nil
-	}
-}
-
-func sendReady(state *connState) error {
-	ev := protocol.ReadyEvent{
-		Type:       protocol.EventReady,
-		Protocol:   "ion",
-		SampleRate: defaultSampleRate,
-		Channels:   defaultChannels,
-		Format:     defaultFormat,
-	}
-	data, err := protocol.Encode(ev)
-	if err != nil {
+	srv.Handle(protocol.EventDescribe, func(s *server.Session, ev protocol.Event) error {
+		// The capture backends convert, so any layout the client asks for
+		// is fine.
+		_, err := s.Negotiate(ev.(protocol.DescribeEvent), defaultAudioFormat, protocol.AudioFormat{})
 		return err
-	}
-
-	frame := &protocol.Frame{
-		Version: protocol.VersionByte,
-		Type:    protocol.FrameTypeJSON,
-		Length:  uint32(len(data)),
-		Payload: data,
-	}
-	return state.writeFrame(frame)
+	})
+	srv.Handle(protocol.EventStart, func(s *server.Session, _ protocol.Event) error {
+		return startStreaming(stateOf(s))
+	})
+	srv.Handle(protocol.EventStop, func(s *server.Session, _ protocol.Event) error {
+		return stopStreaming(stateOf(s))
+	})
+	// This node is a source; incoming audio is ignored.
+	return srv
 }
 
-func (s *connState) writeFrame(f *protocol.Frame) error {
-	s.outMu.Lock()
-	defer s.outMu.Unlock()
-
-	if err := protocol.WriteFrame(s.out, f); err != nil {
-		return err
-	}
-	return s.out.Flush()
+func stateOf(s *server.Session) *connState {
+	return s.Value().(*connState)
 }
 
 func startStreaming(s *connState) error {
@@ -159,10 +107,21 @@ func startStreaming(s *connState) error {
 		return nil
 	}
 
-	cap, err := audio.NewPipewireCapture(defaultSampleRate, defaultChannels)
+	f, ok := s.sess.Format()
+	if !ok {
+		f = defaultAudioFormat
+	}
+	format := audio.Format{SampleRate: f.SampleRate, Channels: f.Channels, Encoding: f.Format}
+	cap, err := audio.OpenSource(sourceURI, format)
 	if err != nil {
 		return err
 	}
+	conv, err := audio.ConvertSource(cap, format)
+	if err != nil {
+		_ = cap.Close()
+		return err
+	}
+	cap = conv
 	s.capture = cap
 	s.streamOn = true
 
@@ -186,8 +145,6 @@ func stopStreaming(s *connState) error {
 }
 
 func streamLoop(s *connState) {
-	framesPerChunk := defaultSampleRate / 50
-
 	s.streamMu.Lock()
 	cap := s.capture
 	s.streamMu.Unlock()
@@ -195,11 +152,9 @@ func streamLoop(s *connState) {
 		return
 	}
 
-	frameSize := cap.FrameSize()
-	if frameSize <= 0 {
-		frameSize = 2 * defaultChannels
-	}
-	buf := make([]byte, framesPerChunk*frameSize)
+	format := cap.Format()
+	framesPerChunk := format.SampleRate / 50
+	buf := make([]byte, framesPerChunk*format.FrameSize())
 
 	for {
 		s.streamMu.Lock()
@@ -213,13 +168,7 @@ func streamLoop(s *connState) {
 
 		n, err := cap.Read(buf)
 		if n > 0 {
-			frame := &protocol.Frame{
-				Version: protocol.VersionByte,
-				Type:    protocol.FrameTypeAudio,
-				Length:  uint32(n),
-				Payload: buf[:n],
-			}
-			if werr := s.writeFrame(frame); werr != nil {
+			if werr := s.sess.SendAudio(buf[:n]); werr != nil {
 				log.Println("write audio frame:", werr)
 				return
 			}
@@ -235,42 +184,26 @@ func streamLoop(s *connState) {
 }
 
 func runClient(transport, addr string) {
-	describe := protocol.BaseEvent{Type: protocol.EventDescribe}
-	data, err := protocol.Encode(describe)
-	if err != nil {
-		log.Fatal(err)
-	}
-	frame := &protocol.Frame{
-		Version: protocol.VersionByte,
-		Type:    protocol.FrameTypeJSON,
-		Length:  uint32(len(data)),
-		Payload: data,
-	}
+	ctx := context.Background()
 
+	var c *client.Client
 	switch transport {
 	case "stdio":
-		if err := protocol.WriteFrame(os.Stdout, frame); err != nil {
-			log.Fatal(err)
-		}
+		c = client.New(os.Stdin, os.Stdout, nil)
 	case "tcp":
-		c, err := net.Dial("tcp", addr)
+		var err error
+		c, err = client.Dial(ctx, addr)
 		if err != nil {
 			log.Fatal(err)
 		}
-		defer c.Close()
-
-		if err := protocol.WriteFrame(c, frame); err != nil {
-			log.Fatal(err)
-		}
-
-		reply, err := protocol.ReadFrame(bufio.NewReader(c))
-		if err == nil && reply.Type == protocol.FrameTypeJSON {
-			var base protocol.BaseEvent
-			if derr := protocol.Decode(reply.Payload, &base); derr == nil {
-				fmt.Fprintln(os.Stderr, "reply:", base.Type)
-			}
-		}
 	default:
 		log.Fatalf("unknown transport: %s", transport)
 	}
+	defer c.Close()
+
+	ready, err := c.Handshake(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(os.Stderr, "reply:", ready.Type)
 }
@@ -1,6 +1,16 @@
 package protocol
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrMalformedJSON = errors.New("protocol: malformed JSON event")
+	ErrMissingType   = errors.New("protocol: event missing type")
+)
 
 type EventType string
 
@@ -42,115 +52,259 @@ const (
 	EventTTSDone  EventType = "tts.done"
 	EventTTSStop  EventType = "tts.stop"
 	EventTTSError EventType = "tts.error"
+
+	EventTTSVoices       EventType = "tts.voices"
+	EventTTSVoicesResult EventType = "tts.voices.result"
+
+	EventTTSChunk EventType = "tts.chunk"
+	EventTTSEnd   EventType = "tts.end"
 )
 
+// Event is implemented by every event struct. EventType reports the wire
+// type even if the Type field was left empty.
+type Event interface {
+	EventType() EventType
+}
+
 type BaseEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (e BaseEvent) EventType() EventType { return e.Type }
+
+// RawEvent carries an event whose type is not registered. It encodes back
+// to the original payload.
+type RawEvent struct {
+	Type    EventType
+	Payload json.RawMessage
+}
+
+func (e RawEvent) EventType() EventType { return e.Type }
+
+func (e RawEvent) MarshalJSON() ([]byte, error) {
+	if len(e.Payload) == 0 {
+		return json.Marshal(BaseEvent{Type: e.Type})
+	}
+	return e.Payload, nil
+}
+
+// DescribeEvent optionally lists the audio formats the client can handle;
+// see Negotiate.
+type DescribeEvent struct {
+	Type      EventType     `json:"type"`
+	Formats   []AudioFormat `json:"formats,omitempty"`
+	Preferred *AudioFormat  `json:"preferred,omitempty"`
+}
+
+func (DescribeEvent) EventType() EventType { return EventDescribe }
+
 type ReadyEvent struct {
-	Type       EventType `json:"type"`
-	Protocol   string    `json:"protocol"`
-	SampleRate int       `json:"sample_rate"`
-	Channels   int       `json:"channels"`
-	Format     string    `json:"format"`
+	Type       EventType    `json:"type"`
+	Protocol   string       `json:"protocol"`
+	SampleRate int          `json:"sample_rate"`
+	Channels   int          `json:"channels"`
+	Format     SampleFormat `json:"format"`
 }
 
+func (ReadyEvent) EventType() EventType { return EventReady }
+
 type StartEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (StartEvent) EventType() EventType { return EventStart }
+
 type StopEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (StopEvent) EventType() EventType { return EventStop }
+
 type ErrorEvent struct {
 	Type    EventType `json:"type"`
 	Message string    `json:"message"`
 }
 
+func (ErrorEvent) EventType() EventType { return EventError }
+
 type SatelliteHelloEvent struct {
-	Type       EventType `json:"type"`
-	Name       string    `json:"name"`
-	SampleRate int       `json:"sample_rate"`
-	Channels   int       `json:"channels"`
-	Format     string    `json:"format"`
-	Wake       bool      `json:"wake,omitempty"`
-	VAD        bool      `json:"vad,omitempty"`
-	ASR        bool      `json:"asr,omitempty"`
-	TTS        bool      `json:"tts,omitempty"`
+	Type       EventType    `json:"type"`
+	Name       string       `json:"name"`
+	SampleRate int          `json:"sample_rate"`
+	Channels   int          `json:"channels"`
+	Format     SampleFormat `json:"format"`
+	Wake       bool         `json:"wake,omitempty"`
+	VAD        bool         `json:"vad,omitempty"`
+	ASR        bool         `json:"asr,omitempty"`
+	TTS        bool         `json:"tts,omitempty"`
 }
 
+func (SatelliteHelloEvent) EventType() EventType { return EventSatelliteHello }
+
 type SatelliteStateEvent struct {
 	Type  EventType `json:"type"`
 	State string    `json:"state"`
 }
 
+func (SatelliteStateEvent) EventType() EventType { return EventSatelliteState }
+
 type WakeDetectedEvent struct {
 	Type EventType `json:"type"`
 	Name string    `json:"name,omitempty"`
 }
 
+func (WakeDetectedEvent) EventType() EventType { return EventWakeDetected }
+
 type WakeResetEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (WakeResetEvent) EventType() EventType { return EventWakeReset }
+
 type VADStartEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (VADStartEvent) EventType() EventType { return EventVADStart }
+
 type VADStopEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (VADStopEvent) EventType() EventType { return EventVADStop }
+
 type ASRStartEvent struct {
 	Type     EventType `json:"type"`
 	Language string    `json:"language,omitempty"`
 }
 
+func (ASRStartEvent) EventType() EventType { return EventASRStart }
+
 type ASRStopEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (ASRStopEvent) EventType() EventType { return EventASRStop }
+
 type ASRPartialEvent struct {
 	Type EventType `json:"type"`
 	Text string    `json:"text"`
 }
 
+func (ASRPartialEvent) EventType() EventType { return EventASRPartial }
+
 type ASRResultEvent struct {
 	Type EventType `json:"type"`
 	Text string    `json:"text"`
 }
 
+func (ASRResultEvent) EventType() EventType { return EventASRResult }
+
 type ASRErrorEvent struct {
 	Type    EventType `json:"type"`
 	Message string    `json:"message"`
 }
 
+func (ASRErrorEvent) EventType() EventType { return EventASRError }
+
 type TTSStartEvent struct {
 	Type     EventType `json:"type"`
 	Text     string    `json:"text"`
 	Voice    string    `json:"voice,omitempty"`
 	Language string    `json:"language,omitempty"`
+	Rate     float64   `json:"rate,omitempty"` // speaking rate, 1 is normal
+
+	// Stream means Text is only the start: more follows in tts.chunk
+	// events until tts.end.
+	Stream bool `json:"stream,omitempty"`
+}
+
+func (TTSStartEvent) EventType() EventType { return EventTTSStart }
+
+// TTSChunkEvent appends text to a streamed tts.start.
+type TTSChunkEvent struct {
+	Type EventType `json:"type"`
+	Text string    `json:"text"`
+}
+
+func (TTSChunkEvent) EventType() EventType { return EventTTSChunk }
+
+// TTSEndEvent marks the end of a streamed tts.start's text.
+type TTSEndEvent struct {
+	Type EventType `json:"type"`
 }
 
+func (TTSEndEvent) EventType() EventType { return EventTTSEnd }
+
 type TTSReadyEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (TTSReadyEvent) EventType() EventType { return EventTTSReady }
+
 type TTSDoneEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (TTSDoneEvent) EventType() EventType { return EventTTSDone }
+
 type TTSStopEvent struct {
 	Type EventType `json:"type"`
 }
 
+func (TTSStopEvent) EventType() EventType { return EventTTSStop }
+
 type TTSErrorEvent struct {
 	Type    EventType `json:"type"`
 	Message string    `json:"message"`
 }
 
+func (TTSErrorEvent) EventType() EventType { return EventTTSError }
+
+// TTSVoicesEvent asks for the voices tts.start accepts, optionally only
+// those speaking Language.
+type TTSVoicesEvent struct {
+	Type     EventType `json:"type"`
+	Language string    `json:"language,omitempty"`
+}
+
+func (TTSVoicesEvent) EventType() EventType { return EventTTSVoices }
+
+type TTSVoicesResultEvent struct {
+	Type   EventType `json:"type"`
+	Voices []Voice   `json:"voices"`
+}
+
+func (TTSVoicesResultEvent) EventType() EventType { return EventTTSVoicesResult }
+
+// Voice describes one synthesizer voice. ID is what tts.start takes.
+type Voice struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	Languages  []string `json:"languages,omitempty"`
+	Gender     string   `json:"gender,omitempty"` // "female", "male" or empty
+	Tags       []string `json:"tags,omitempty"`
+	SampleRate int      `json:"sample_rate,omitempty"` // native rate before conversion
+}
+
+// Speaks reports whether v speaks language. Languages match on their
+// primary subtag, so "en" matches "en-GB" and "en_US", and "en-US" matches
+// "en_US".
+func (v Voice) Speaks(language string) bool {
+	want := normalizeLanguage(language)
+	for _, l := range v.Languages {
+		l = normalizeLanguage(l)
+		if l == want || strings.HasPrefix(l, want+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeLanguage(l string) string {
+	return strings.ToLower(strings.ReplaceAll(l, "_", "-"))
+}
+
 func Encode(v any) ([]byte, error) {
 	return json.Marshal(v)
 }
@@ -158,3 +312,15 @@ func Encode(v any) ([]byte, error) {
 func Decode(data []byte, v any) error {
 	return json.Unmarshal(data, v)
 }
+
+// ParseEventType validates a JSON frame payload and returns its type.
+func ParseEventType(payload []byte) (EventType, error) {
+	var base BaseEvent
+	if err := json.Unmarshal(payload, &base); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformedJSON, err)
+	}
+	if base.Type == "" {
+		return "", ErrMissingType
+	}
+	return base.Type, nil
+}
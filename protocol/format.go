@@ -0,0 +1,248 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrUnknownFormat = errors.New("protocol: unknown sample format")
+	ErrInvalidReady  = errors.New("protocol: invalid ready event")
+)
+
+// SampleFormat names the encoding of one PCM sample in audio frames.
+// Multi-byte formats are little-endian; mulaw and alaw are G.711.
+type SampleFormat string
+
+const (
+	FormatS16LE SampleFormat = "s16le"
+	FormatS24LE SampleFormat = "s24le"
+	FormatS32LE SampleFormat = "s32le"
+	FormatF32LE SampleFormat = "f32le"
+	FormatU8    SampleFormat = "u8"
+	FormatMulaw SampleFormat = "mulaw"
+	FormatAlaw  SampleFormat = "alaw"
+)
+
+var SampleFormats = []SampleFormat{
+	FormatS16LE, FormatS24LE, FormatS32LE, FormatF32LE, FormatU8, FormatMulaw, FormatAlaw,
+}
+
+// BytesPerSample returns the size of one sample, or 0 if f is unknown.
+func (f SampleFormat) BytesPerSample() int {
+	switch f {
+	case FormatU8, FormatMulaw, FormatAlaw:
+		return 1
+	case FormatS16LE:
+		return 2
+	case FormatS24LE:
+		return 3
+	case FormatS32LE, FormatF32LE:
+		return 4
+	}
+	return 0
+}
+
+func (f SampleFormat) Valid() bool {
+	return f.BytesPerSample() > 0
+}
+
+func (f SampleFormat) String() string {
+	return string(f)
+}
+
+// Validate checks the stream parameters a ready event announces.
+// Limits on stream formats. A peer picks the format the other side converts
+// from, so these bound the work and memory a describe can ask for.
+const (
+	MinSampleRate = 8000
+	MaxSampleRate = 192000
+	MaxChannels   = 32
+)
+
+func (e ReadyEvent) Validate() error {
+	switch {
+	case e.SampleRate < MinSampleRate || e.SampleRate > MaxSampleRate:
+		return fmt.Errorf("%w: sample_rate %d outside %d-%d", ErrInvalidReady, e.SampleRate, MinSampleRate, MaxSampleRate)
+	case e.Channels <= 0 || e.Channels > MaxChannels:
+		return fmt.Errorf("%w: channels %d outside 1-%d", ErrInvalidReady, e.Channels, MaxChannels)
+	case !e.Format.Valid():
+		return fmt.Errorf("%w: %w %q", ErrInvalidReady, ErrUnknownFormat, e.Format)
+	}
+	return nil
+}
+
+// FrameSize is the number of bytes holding one sample for every channel.
+func (e ReadyEvent) FrameSize() int {
+	return e.Format.BytesPerSample() * e.Channels
+}
+
+// DecodeSamples appends the samples in pcm to dst as floats in [-1, 1).
+// A trailing partial sample is ignored.
+func DecodeSamples(dst []float32, f SampleFormat, pcm []byte) ([]float32, error) {
+	bps := f.BytesPerSample()
+	if bps == 0 {
+		return dst, fmt.Errorf("%w: %q", ErrUnknownFormat, f)
+	}
+	n := len(pcm) / bps
+	for i := 0; i < n; i++ {
+		b := pcm[i*bps:]
+		var v float32
+		switch f {
+		case FormatS16LE:
+			v = float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		case FormatS24LE:
+			v = float32(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+		case FormatS32LE:
+			v = float32(float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31))
+		case FormatF32LE:
+			v = math.Float32frombits(binary.LittleEndian.Uint32(b))
+		case FormatU8:
+			v = float32(int(b[0])-128) / (1 << 7)
+		case FormatMulaw:
+			v = float32(mulawDecode(b[0])) / (1 << 15)
+		case FormatAlaw:
+			v = float32(alawDecode(b[0])) / (1 << 15)
+		}
+		dst = append(dst, v)
+	}
+	return dst, nil
+}
+
+// EncodeSamples appends samples to dst in format f, clipping to full scale.
+func EncodeSamples(dst []byte, f SampleFormat, samples []float32) ([]byte, error) {
+	if !f.Valid() {
+		return dst, fmt.Errorf("%w: %q", ErrUnknownFormat, f)
+	}
+	for _, s := range samples {
+		v := float64(s)
+		switch f {
+		case FormatS16LE:
+			dst = binary.LittleEndian.AppendUint16(dst, uint16(int16(quantize(v, 1<<15))))
+		case FormatS24LE:
+			x := int32(quantize(v, 1<<23))
+			dst = append(dst, byte(x), byte(x>>8), byte(x>>16))
+		case FormatS32LE:
+			dst = binary.LittleEndian.AppendUint32(dst, uint32(int32(quantize(v, 1<<31))))
+		case FormatF32LE:
+			dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(s))
+		case FormatU8:
+			dst = append(dst, byte(quantize(v, 1<<7)+128))
+		case FormatMulaw:
+			dst = append(dst, mulawEncode(int16(quantize(v, 1<<15))))
+		case FormatAlaw:
+			dst = append(dst, alawEncode(int16(quantize(v, 1<<15))))
+		}
+	}
+	return dst, nil
+}
+
+// ConvertSamples re-encodes pcm from one sample format to another. The
+// channel layout and rate are unchanged.
+func ConvertSamples(to, from SampleFormat, pcm []byte) ([]byte, error) {
+	if !to.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, to)
+	}
+	if to == from {
+		if !from.Valid() {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, from)
+		}
+		return append([]byte(nil), pcm[:len(pcm)/from.BytesPerSample()*from.BytesPerSample()]...), nil
+	}
+	samples, err := DecodeSamples(nil, from, pcm)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeSamples(make([]byte, 0, len(samples)*to.BytesPerSample()), to, samples)
+}
+
+// quantize scales v to a signed integer of the given full scale, rounding
+// and clipping to [-scale, scale-1].
+func quantize(v float64, scale float64) int64 {
+	x := math.Round(v * scale)
+	if x >= scale {
+		return int64(scale) - 1
+	}
+	if x < -scale {
+		return -int64(scale)
+	}
+	return int64(x)
+}
+
+const (
+	mulawBias = 0x84
+	mulawClip = 32635
+)
+
+func mulawEncode(s int16) byte {
+	x := int(s)
+	sign := 0
+	if x < 0 {
+		sign = 0x80
+		x = -x
+	}
+	if x > mulawClip {
+		x = mulawClip
+	}
+	x += mulawBias
+	exp := 7
+	for mask := 0x4000; x&mask == 0 && exp > 0; mask >>= 1 {
+		exp--
+	}
+	mantissa := (x >> (exp + 3)) & 0x0F
+	return ^byte(sign | exp<<4 | mantissa)
+}
+
+func mulawDecode(u byte) int16 {
+	u = ^u
+	t := (int(u&0x0F)<<3 + mulawBias) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return int16(mulawBias - t)
+	}
+	return int16(t - mulawBias)
+}
+
+var alawSegEnd = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+
+func alawEncode(s int16) byte {
+	x := int(s) >> 3
+	mask := byte(0xD5)
+	if x < 0 {
+		mask = 0x55
+		x = -x - 1
+	}
+	seg := 0
+	for seg < 8 && x > alawSegEnd[seg] {
+		seg++
+	}
+	if seg >= 8 {
+		return 0x7F ^ mask
+	}
+	a := byte(seg << 4)
+	if seg < 2 {
+		a |= byte(x>>1) & 0x0F
+	} else {
+		a |= byte(x>>seg) & 0x0F
+	}
+	return a ^ mask
+}
+
+func alawDecode(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	switch seg := int(a&0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
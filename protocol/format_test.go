@@ -0,0 +1,98 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestConvertSamplesRoundtrip(t *testing.T) {
+	src := []float32{0, 0.5, -0.5, 0.999, -1, 0.001}
+	for _, f := range SampleFormats {
+		pcm, err := EncodeSamples(nil, f, src)
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if len(pcm) != len(src)*f.BytesPerSample() {
+			t.Fatalf("%s: %d bytes for %d samples", f, len(pcm), len(src))
+		}
+		got, err := DecodeSamples(nil, f, pcm)
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		// G.711 keeps about 4 bits of mantissa, u8 has 7.
+		tol := 1e-4
+		switch f {
+		case FormatU8:
+			tol = 1.0 / 128
+		case FormatMulaw, FormatAlaw:
+			tol = 0.035
+		}
+		for i := range src {
+			if d := math.Abs(float64(got[i] - src[i])); d > tol*math.Max(1, 2*math.Abs(float64(src[i]))) {
+				t.Fatalf("%s: sample %d: got %v, want %v", f, i, got[i], src[i])
+			}
+		}
+	}
+}
+
+func TestConvertSamplesIntegerExact(t *testing.T) {
+	s16 := []byte{0x00, 0x80, 0xff, 0x7f, 0x01, 0x00, 0xff, 0xff}
+	s24, err := ConvertSamples(FormatS24LE, FormatS16LE, s16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x00, 0x00, 0x80, 0x00, 0xff, 0x7f, 0x00, 0x01, 0x00, 0x00, 0xff, 0xff}
+	if string(s24) != string(want) {
+		t.Fatalf("s24 = % x", s24)
+	}
+	back, err := ConvertSamples(FormatS16LE, FormatS24LE, s24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != string(s16) {
+		t.Fatalf("s16 = % x", back)
+	}
+
+	// Every G.711 code decodes to a value that encodes back to itself,
+	// except the duplicate mu-law zero.
+	for i := 0; i < 256; i++ {
+		if a := alawEncode(alawDecode(byte(i))); a != byte(i) {
+			t.Fatalf("alaw %#x -> %#x", i, a)
+		}
+		if u := mulawEncode(mulawDecode(byte(i))); u != byte(i) && i != 0x7f {
+			t.Fatalf("mulaw %#x -> %#x", i, u)
+		}
+	}
+}
+
+func TestEncodeClips(t *testing.T) {
+	pcm, _ := EncodeSamples(nil, FormatS16LE, []float32{2, -2})
+	if got, _ := DecodeSamples(nil, FormatS16LE, pcm); got[0] != 32767.0/32768 || got[1] != -1 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestReadyValidate(t *testing.T) {
+	ok := ReadyEvent{SampleRate: 8000, Channels: 1, Format: FormatMulaw}
+	if err := ok.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ok.FrameSize() != 1 {
+		t.Fatalf("frame size %d", ok.FrameSize())
+	}
+	for _, ev := range []ReadyEvent{
+		{SampleRate: 0, Channels: 1, Format: FormatS16LE},
+		{SampleRate: 16000, Channels: 0, Format: FormatS16LE},
+		{SampleRate: 4800007, Channels: 1, Format: FormatS16LE},
+		{SampleRate: 16000, Channels: 33, Format: FormatS16LE},
+		{SampleRate: 16000, Channels: 1, Format: "s16be"},
+	} {
+		if err := ev.Validate(); !errors.Is(err, ErrInvalidReady) {
+			t.Fatalf("%+v: %v", ev, err)
+		}
+	}
+	if err := (ReadyEvent{SampleRate: 16000, Channels: 1, Format: "pcm"}).Validate(); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("unknown format: %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package protocol
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 )
 
@@ -12,6 +14,35 @@ const (
 	FrameTypeAudio = 0x02
 )
 
+const (
+	DefaultMaxJSONLength  = 64 << 10
+	DefaultMaxAudioLength = 1 << 20
+	DefaultMaxFrameLength = 1 << 20
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("protocol: unsupported version")
+	ErrUnknownFrameType   = errors.New("protocol: unknown frame type")
+	ErrFrameTooLarge      = errors.New("protocol: frame too large")
+)
+
+type FrameTooLargeError struct {
+	Type   byte
+	Length uint32
+	Limit  uint32
+	// Skipped reports that the payload was drained and the stream is
+	// positioned at the next frame header.
+	Skipped bool
+}
+
+func (e *FrameTooLargeError) Error() string {
+	return fmt.Sprintf("protocol: frame type 0x%02x length %d exceeds limit %d", e.Type, e.Length, e.Limit)
+}
+
+func (e *FrameTooLargeError) Is(target error) bool {
+	return target == ErrFrameTooLarge
+}
+
 type Frame struct {
 	Version byte
 	Type    byte
@@ -19,22 +50,68 @@ type Frame struct {
 	Payload []byte
 }
 
+// ReadFrame reads one frame using the default per-type length limits.
 func ReadFrame(r io.Reader) (*Frame, error) {
-	header := make([]byte, 6)
+	return readFrame(r, defaultLimit, false, false)
+}
 
-	if _, err := io.ReadFull(r, header); err != nil {
+func KnownFrameType(t byte) bool {
+	return t == FrameTypeJSON || t == FrameTypeAudio
+}
+
+func defaultLimit(t byte) uint32 {
+	switch t {
+	case FrameTypeJSON:
+		return DefaultMaxJSONLength
+	case FrameTypeAudio:
+		return DefaultMaxAudioLength
+	default:
+		return DefaultMaxFrameLength
+	}
+}
+
+func readFrame(r io.Reader, limit func(byte) uint32, skip, strictTypes bool) (*Frame, error) {
+	var header [6]byte
+	f, err := readHeader(r, header[:], limit, skip, strictTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Payload = make([]byte, f.Length)
+	if _, err := io.ReadFull(r, f.Payload); err != nil {
 		return nil, err
 	}
 
-	f := &Frame{
+	return &f, nil
+}
+
+func readHeader(r io.Reader, header []byte, limit func(byte) uint32, skip, strictTypes bool) (Frame, error) {
+	if _, err := io.ReadFull(r, header[:6]); err != nil {
+		return Frame{}, err
+	}
+
+	f := Frame{
 		Version: header[0],
 		Type:    header[1],
 		Length:  binary.LittleEndian.Uint32(header[2:6]),
 	}
 
-	f.Payload = make([]byte, f.Length)
-	if _, err := io.ReadFull(r, f.Payload); err != nil {
-		return nil, err
+	if f.Version != VersionByte {
+		return Frame{}, fmt.Errorf("%w: 0x%02x", ErrUnsupportedVersion, f.Version)
+	}
+	if strictTypes && !KnownFrameType(f.Type) {
+		return Frame{}, fmt.Errorf("%w: 0x%02x", ErrUnknownFrameType, f.Type)
+	}
+
+	if max := limit(f.Type); max > 0 && f.Length > max {
+		tooLarge := &FrameTooLargeError{Type: f.Type, Length: f.Length, Limit: max}
+		if skip {
+			if _, err := io.CopyN(io.Discard, r, int64(f.Length)); err != nil {
+				return Frame{}, err
+			}
+			tooLarge.Skipped = true
+		}
+		return Frame{}, tooLarge
 	}
 
 	return f, nil
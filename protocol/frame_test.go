@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -27,3 +28,71 @@ func TestFrameRoundtrip(t *testing.T) {
 		t.Fatal("payload mismatch")
 	}
 }
+
+func rawHeader(t byte, length uint32) []byte {
+	return []byte{VersionByte, t, byte(length), byte(length >> 8), byte(length >> 16), byte(length >> 24)}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	buf := bytes.NewReader(rawHeader(FrameTypeJSON, 0xFFFFFFFF))
+
+	_, err := ReadFrame(buf)
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("got %v, want ErrFrameTooLarge", err)
+	}
+}
+
+func TestReaderSkipOversize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	buf.Write(rawHeader(FrameTypeAudio, 8))
+	buf.Write(make([]byte, 8))
+	if err := WriteFrame(buf, &Frame{Version: VersionByte, Type: FrameTypeAudio, Length: 2, Payload: []byte{1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rd := NewReader(buf)
+	rd.SetLimit(FrameTypeAudio, 4)
+	rd.SkipOversize = true
+
+	_, err := rd.ReadFrame()
+	var tooLarge *FrameTooLargeError
+	if !errors.As(err, &tooLarge) || !tooLarge.Skipped || tooLarge.Limit != 4 {
+		t.Fatalf("got %v, want skipped FrameTooLargeError", err)
+	}
+
+	f, err := rd.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.Payload, []byte{1, 2}) {
+		t.Fatalf("payload mismatch: %v", f.Payload)
+	}
+}
+
+func TestReadFrameUnsupportedVersion(t *testing.T) {
+	hdr := rawHeader(FrameTypeJSON, 0)
+	hdr[0] = 0x02
+
+	_, err := ReadFrame(bytes.NewReader(hdr))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("got %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestParseEventType(t *testing.T) {
+	cases := []struct {
+		payload string
+		want    error
+	}{
+		{`{"type":"describe"}`, nil},
+		{`{"type":`, ErrMalformedJSON},
+		{`[1,2]`, ErrMalformedJSON},
+		{`{}`, ErrMissingType},
+	}
+	for _, c := range cases {
+		_, err := ParseEventType([]byte(c.payload))
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.payload, err, c.want)
+		}
+	}
+}
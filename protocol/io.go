@@ -5,6 +5,56 @@ import (
 	"io"
 )
 
+type Reader struct {
+	r io.Reader
+
+	// Limits caps the payload length per frame type; types without an
+	// entry fall back to MaxLength. Zero means unlimited.
+	Limits    map[byte]uint32
+	MaxLength uint32
+
+	// SkipOversize drains oversized payloads so reading can continue.
+	// Otherwise the stream is left mid-frame and must be closed.
+	SkipOversize bool
+
+	// RejectUnknownTypes fails on frame types other than JSON and audio.
+	// By default they are returned so callers can ignore them.
+	RejectUnknownTypes bool
+}
+
+func NewReader(in io.Reader) *Reader {
+	return &Reader{
+		r: in,
+		Limits: map[byte]uint32{
+			FrameTypeJSON:  DefaultMaxJSONLength,
+			FrameTypeAudio: DefaultMaxAudioLength,
+		},
+		MaxLength: DefaultMaxFrameLength,
+	}
+}
+
+func (rd *Reader) SetLimit(frameType byte, max uint32) {
+	if rd.Limits == nil {
+		rd.Limits = make(map[byte]uint32)
+	}
+	rd.Limits[frameType] = max
+}
+
+func (rd *Reader) Limit(frameType byte) uint32 {
+	if max, ok := rd.Limits[frameType]; ok {
+		return max
+	}
+	return rd.MaxLength
+}
+
+func (rd *Reader) ReadFrame() (*Frame, error) {
+	return readFrame(rd.r, rd.Limit, rd.SkipOversize, rd.RejectUnknownTypes)
+}
+
+// Tap observes frames as they are sent or received, for example to record
+// a session. The frame must not be retained after the call.
+type Tap func(dir Direction, f *Frame)
+
 type Writer struct {
 	w *bufio.Writer
 }
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNoCommonFormat = errors.New("protocol: no common audio format")
+
+// AudioFormat is the stream format carried in describe and ready.
+type AudioFormat struct {
+	SampleRate int          `json:"sample_rate"`
+	Channels   int          `json:"channels"`
+	Format     SampleFormat `json:"format"`
+}
+
+func (f AudioFormat) Validate() error {
+	return ReadyEvent{SampleRate: f.SampleRate, Channels: f.Channels, Format: f.Format}.Validate()
+}
+
+func (f AudioFormat) String() string {
+	return fmt.Sprintf("%s %dHz %dch", f.Format, f.SampleRate, f.Channels)
+}
+
+// matches reports whether f is covered by pattern. Zero fields in pattern
+// match anything.
+func (f AudioFormat) matches(pattern AudioFormat) bool {
+	return (pattern.SampleRate == 0 || pattern.SampleRate == f.SampleRate) &&
+		(pattern.Channels == 0 || pattern.Channels == f.Channels) &&
+		(pattern.Format == "" || pattern.Format == f.Format)
+}
+
+// AudioFormat returns the stream format the ready event announces.
+func (e ReadyEvent) AudioFormat() AudioFormat {
+	return AudioFormat{SampleRate: e.SampleRate, Channels: e.Channels, Format: e.Format}
+}
+
+// Ready returns a ready event announcing f.
+func (f AudioFormat) Ready() ReadyEvent {
+	return ReadyEvent{
+		Type:       EventReady,
+		Protocol:   "ion",
+		SampleRate: f.SampleRate,
+		Channels:   f.Channels,
+		Format:     f.Format,
+	}
+}
+
+// Negotiate picks the stream format for a describe request. supported is
+// the server's list in order of preference; zero fields act as wildcards,
+// which is how a server that converts audio accepts any rate or layout.
+//
+// The client's preferred format wins if supported, then its other formats
+// in the order given. A describe without formats gets the server's first
+// entry, which must then be fully specified.
+func Negotiate(supported []AudioFormat, describe DescribeEvent) (AudioFormat, error) {
+	if len(supported) == 0 {
+		return AudioFormat{}, fmt.Errorf("%w: server supports no formats", ErrNoCommonFormat)
+	}
+
+	offered := describe.Formats
+	if describe.Preferred != nil {
+		offered = append([]AudioFormat{*describe.Preferred}, offered...)
+	}
+	if len(offered) == 0 {
+		f := supported[0]
+		if err := f.Validate(); err != nil {
+			return AudioFormat{}, fmt.Errorf("%w: default %v is incomplete", ErrNoCommonFormat, f)
+		}
+		return f, nil
+	}
+
+	for _, f := range offered {
+		if f.Validate() != nil {
+			continue
+		}
+		for _, s := range supported {
+			if f.matches(s) {
+				return f, nil
+			}
+		}
+	}
+	return AudioFormat{}, fmt.Errorf("%w: client offered %v", ErrNoCommonFormat, offered)
+}
@@ -0,0 +1,39 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	native := AudioFormat{SampleRate: 16000, Channels: 1, Format: FormatS16LE}
+	mic := AudioFormat{SampleRate: 48000, Channels: 2, Format: FormatS16LE}
+	phone := AudioFormat{SampleRate: 8000, Channels: 1, Format: FormatMulaw}
+
+	for _, tc := range []struct {
+		name      string
+		supported []AudioFormat
+		describe  DescribeEvent
+		want      AudioFormat
+		err       error
+	}{
+		{"no offer", []AudioFormat{native}, DescribeEvent{}, native, nil},
+		{"exact", []AudioFormat{native}, DescribeEvent{Formats: []AudioFormat{mic, native}}, native, nil},
+		{"preferred wins", []AudioFormat{native, {}}, DescribeEvent{Formats: []AudioFormat{native}, Preferred: &mic}, mic, nil},
+		{"client order", []AudioFormat{native, {}}, DescribeEvent{Formats: []AudioFormat{phone, native}}, phone, nil},
+		{"partial wildcard", []AudioFormat{{Format: FormatS16LE}}, DescribeEvent{Formats: []AudioFormat{phone, mic}}, mic, nil},
+		{"invalid offer skipped", []AudioFormat{{}}, DescribeEvent{Formats: []AudioFormat{{SampleRate: 16000, Format: "pcm"}, native}}, native, nil},
+		{"none", []AudioFormat{native}, DescribeEvent{Formats: []AudioFormat{phone}}, AudioFormat{}, ErrNoCommonFormat},
+		{"wildcard default", []AudioFormat{{}}, DescribeEvent{}, AudioFormat{}, ErrNoCommonFormat},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Negotiate(tc.supported, tc.describe)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
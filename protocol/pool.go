@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"sync"
+)
+
+const minPooledPayload = 512
+
+var framePool = sync.Pool{
+	New: func() any { return new(Frame) },
+}
+
+// FrameReader reads frames into pooled buffers. Every frame returned by
+// ReadFrame must be handed back with Release once the payload is no longer
+// referenced.
+type FrameReader struct {
+	Reader
+	header [6]byte
+}
+
+func NewFrameReader(in io.Reader) *FrameReader {
+	return &FrameReader{Reader: *NewReader(in)}
+}
+
+func (fr *FrameReader) ReadFrame() (*Frame, error) {
+	hdr, err := readHeader(fr.r, fr.header[:], fr.Limit, fr.SkipOversize, fr.RejectUnknownTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	f := framePool.Get().(*Frame)
+	payload := f.Payload
+	if uint32(cap(payload)) < hdr.Length {
+		size := minPooledPayload
+		for uint32(size) < hdr.Length && size < math.MaxInt32/2 {
+			size *= 2
+		}
+		if uint32(size) < hdr.Length {
+			size = int(hdr.Length)
+		}
+		payload = make([]byte, size)
+	}
+	hdr.Payload = payload[:hdr.Length]
+	*f = hdr
+
+	if _, err := io.ReadFull(fr.r, f.Payload); err != nil {
+		fr.Release(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fr *FrameReader) Release(f *Frame) {
+	if f == nil {
+		return
+	}
+	f.Payload = f.Payload[:0]
+	framePool.Put(f)
+}
+
+type vectoredWrite struct {
+	header  [6]byte
+	backing [2][]byte
+	bufs    net.Buffers
+}
+
+var vectoredPool = sync.Pool{
+	New: func() any { return new(vectoredWrite) },
+}
+
+// WriteAudio writes an audio frame with a single vectored write when w
+// supports it (for example a *net.TCPConn).
+func WriteAudio(w io.Writer, pcm []byte) error {
+	return WritePayload(w, FrameTypeAudio, pcm)
+}
+
+func WriteJSON(w io.Writer, ev any) error {
+	data, err := Encode(ev)
+	if err != nil {
+		return err
+	}
+	return WritePayload(w, FrameTypeJSON, data)
+}
+
+// WritePayload writes a version 1 frame of the given type using the same
+// vectored path as WriteAudio.
+func WritePayload(w io.Writer, frameType byte, payload []byte) error {
+	if uint64(len(payload)) > math.MaxUint32 {
+		return &FrameTooLargeError{Type: frameType, Length: math.MaxUint32, Limit: math.MaxUint32}
+	}
+
+	v := vectoredPool.Get().(*vectoredWrite)
+	v.header[0] = VersionByte
+	v.header[1] = frameType
+	binary.LittleEndian.PutUint32(v.header[2:6], uint32(len(payload)))
+	v.backing[0] = v.header[:]
+	v.backing[1] = payload
+	v.bufs = v.backing[:]
+
+	_, err := v.bufs.WriteTo(w)
+
+	v.backing[1] = nil
+	v.bufs = nil
+	vectoredPool.Put(v)
+	return err
+}
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type loopReader struct {
+	data []byte
+	off  int
+}
+
+func (l *loopReader) Read(p []byte) (int, error) {
+	n := copy(p, l.data[l.off:])
+	l.off = (l.off + n) % len(l.data)
+	return n, nil
+}
+
+func encodedAudioFrame(tb testing.TB, size int) []byte {
+	tb.Helper()
+	buf := new(bytes.Buffer)
+	if err := WriteAudio(buf, make([]byte, size)); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFrameReaderRelease(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := WriteJSON(buf, BaseEvent{Type: EventDescribe}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteAudio(buf, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	fr := NewFrameReader(buf)
+
+	f, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != FrameTypeJSON || string(f.Payload) != `{"type":"describe"}` {
+		t.Fatalf("unexpected frame: %d %s", f.Type, f.Payload)
+	}
+	fr.Release(f)
+
+	f, err = fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != FrameTypeAudio || !bytes.Equal(f.Payload, []byte{1, 2, 3, 4}) {
+		t.Fatalf("unexpected frame: %d %v", f.Type, f.Payload)
+	}
+	fr.Release(f)
+
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Fatalf("got %v, want EOF", err)
+	}
+}
+
+func BenchmarkReadFrame(b *testing.B) {
+	src := &loopReader{data: encodedAudioFrame(b, 640)}
+	b.ReportAllocs()
+	b.SetBytes(640)
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadFrame(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFrameReader(b *testing.B) {
+	fr := NewFrameReader(&loopReader{data: encodedAudioFrame(b, 640)})
+	b.ReportAllocs()
+	b.SetBytes(640)
+	for i := 0; i < b.N; i++ {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			b.Fatal(err)
+		}
+		fr.Release(f)
+	}
+}
+
+func BenchmarkWriteFrame(b *testing.B) {
+	pcm := make([]byte, 640)
+	b.ReportAllocs()
+	b.SetBytes(640)
+	for i := 0; i < b.N; i++ {
+		f := &Frame{Version: VersionByte, Type: FrameTypeAudio, Length: uint32(len(pcm)), Payload: pcm}
+		if err := WriteFrame(io.Discard, f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteAudio(b *testing.B) {
+	pcm := make([]byte, 640)
+	b.ReportAllocs()
+	b.SetBytes(640)
+	for i := 0; i < b.N; i++ {
+		if err := WriteAudio(io.Discard, pcm); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var eventType = reflect.TypeOf((*Event)(nil)).Elem()
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[EventType]reflect.Type)
+)
+
+func init() {
+	for _, ev := range []Event{
+		DescribeEvent{},
+		ReadyEvent{},
+		StartEvent{},
+		StopEvent{},
+		ErrorEvent{},
+		SatelliteHelloEvent{},
+		SatelliteStateEvent{},
+		WakeDetectedEvent{},
+		WakeResetEvent{},
+		VADStartEvent{},
+		VADStopEvent{},
+		ASRStartEvent{},
+		ASRStopEvent{},
+		ASRPartialEvent{},
+		ASRResultEvent{},
+		ASRErrorEvent{},
+		TTSStartEvent{},
+		TTSReadyEvent{},
+		TTSDoneEvent{},
+		TTSStopEvent{},
+		TTSErrorEvent{},
+		TTSVoicesEvent{},
+		TTSVoicesResultEvent{},
+		TTSChunkEvent{},
+		TTSEndEvent{},
+	} {
+		RegisterEvent(ev)
+	}
+}
+
+// RegisterEvent makes DecodeEvent return values of ev's concrete type for
+// ev.EventType(), or pointers if only the pointer type implements Event.
+// Registering a different type for an existing event type panics.
+func RegisterEvent(ev Event) {
+	t := ev.EventType()
+	if t == "" {
+		panic("protocol: RegisterEvent with empty event type")
+	}
+	rt := reflect.TypeOf(ev)
+	if rt.Kind() == reflect.Pointer && rt.Elem().Implements(eventType) {
+		rt = rt.Elem()
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if prev, ok := registry[t]; ok && prev != rt {
+		panic(fmt.Sprintf("protocol: event %q already registered as %s", t, prev))
+	}
+	registry[t] = rt
+}
+
+// DecodeEvent decodes a JSON frame payload into the registered struct for
+// its type. Unregistered types decode into RawEvent so they can be ignored.
+func DecodeEvent(payload []byte) (Event, error) {
+	t, err := ParseEventType(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.RLock()
+	rt, ok := registry[t]
+	registryMu.RUnlock()
+	if !ok {
+		return RawEvent{Type: t, Payload: append(json.RawMessage(nil), payload...)}, nil
+	}
+
+	ptr := rt.Kind() == reflect.Pointer
+	if ptr {
+		rt = rt.Elem()
+	}
+	v := reflect.New(rt)
+	if err := json.Unmarshal(payload, v.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedJSON, err)
+	}
+	if ptr {
+		return v.Interface().(Event), nil
+	}
+	return v.Elem().Interface().(Event), nil
+}
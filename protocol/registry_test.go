@@ -0,0 +1,91 @@
+package protocol
+
+import "testing"
+
+type customEvent struct {
+	Type  EventType `json:"type"`
+	Level int       `json:"level"`
+}
+
+func (customEvent) EventType() EventType { return "test.custom" }
+
+func TestDecodeEvent(t *testing.T) {
+	ev, err := DecodeEvent([]byte(`{"type":"asr.start","language":"en"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, ok := ev.(ASRStartEvent)
+	if !ok || start.Language != "en" {
+		t.Fatalf("got %#v, want ASRStartEvent", ev)
+	}
+
+	ev, err = DecodeEvent([]byte(`{"type":"vendor.thing","x":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := ev.(RawEvent)
+	if !ok || raw.EventType() != "vendor.thing" {
+		t.Fatalf("got %#v, want RawEvent", ev)
+	}
+	if out, _ := Encode(raw); string(out) != `{"type":"vendor.thing","x":1}` {
+		t.Fatalf("raw re-encode: %s", out)
+	}
+}
+
+func TestRegisterEvent(t *testing.T) {
+	RegisterEvent(customEvent{})
+
+	ev, err := DecodeEvent([]byte(`{"type":"test.custom","level":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := ev.(customEvent); !ok || c.Level != 3 {
+		t.Fatalf("got %#v, want customEvent", ev)
+	}
+}
+
+type pointerEvent struct {
+	Type  EventType `json:"type"`
+	Level int       `json:"level"`
+}
+
+func (*pointerEvent) EventType() EventType { return "test.pointer" }
+
+func TestRegisterPointerEvent(t *testing.T) {
+	RegisterEvent(&pointerEvent{})
+
+	ev, err := DecodeEvent([]byte(`{"type":"test.pointer","level":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := ev.(*pointerEvent); !ok || p.Level != 3 {
+		t.Fatalf("got %#v, want *pointerEvent", ev)
+	}
+
+	// A value type registered through a pointer still decodes to a value.
+	RegisterEvent(&customEvent{})
+	ev, err = DecodeEvent([]byte(`{"type":"test.custom","level":4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := ev.(customEvent); !ok || c.Level != 4 {
+		t.Fatalf("got %#v, want customEvent", ev)
+	}
+}
+
+func TestDecodeVoices(t *testing.T) {
+	ev, err := DecodeEvent([]byte(`{"type":"tts.voices.result","voices":[{"id":"en_US-amy","languages":["en_US"],"gender":"female","sample_rate":22050}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, ok := ev.(TTSVoicesResultEvent)
+	if !ok || len(res.Voices) != 1 || res.Voices[0].SampleRate != 22050 {
+		t.Fatalf("got %#v, want TTSVoicesResultEvent", ev)
+	}
+	v := res.Voices[0]
+	for lang, want := range map[string]bool{"en": true, "en-us": true, "EN_US": true, "en-GB": false, "e": false, "de": false} {
+		if v.Speaks(lang) != want {
+			t.Errorf("Speaks(%q) = %v", lang, !want)
+		}
+	}
+}
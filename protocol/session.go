@@ -0,0 +1,376 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Role int
+
+const (
+	RoleClient Role = iota
+	RoleServer
+)
+
+func (r Role) String() string {
+	if r == RoleServer {
+		return "server"
+	}
+	return "client"
+}
+
+// Direction is relative to the endpoint that owns the Session.
+type Direction int
+
+const (
+	Inbound Direction = iota
+	Outbound
+)
+
+func (d Direction) String() string {
+	if d == Outbound {
+		return "outbound"
+	}
+	return "inbound"
+}
+
+var (
+	ErrNotReady          = errors.New("protocol: event before describe/ready handshake")
+	ErrWrongDirection    = errors.New("protocol: event sent by the wrong peer")
+	ErrUnexpectedEvent   = errors.New("protocol: event not allowed in current state")
+	ErrAudioNotAllowed   = errors.New("protocol: audio outside an active stream")
+	ErrAudioAfterTTSStop = errors.New("protocol: audio after tts.stop")
+)
+
+type ViolationError struct {
+	Direction Direction
+	Event     EventType
+	State     string
+	Err       error
+}
+
+func (e *ViolationError) Error() string {
+	return fmt.Sprintf("%v (%s %s in state %s)", e.Err, e.Direction, e.Event, e.State)
+}
+
+func (e *ViolationError) Unwrap() error {
+	return e.Err
+}
+
+type asrPhase int
+
+const (
+	asrIdle asrPhase = iota
+	asrActive
+	asrFinishing
+)
+
+type ttsPhase int
+
+const (
+	ttsIdle ttsPhase = iota
+	ttsRequested
+	ttsSpeaking
+	ttsStopped
+)
+
+const DefaultStopGrace = 250 * time.Millisecond
+
+// Session tracks the SPEC.md session model for one connection. Feed every
+// frame that is sent or received through it; it is safe for concurrent use.
+type Session struct {
+	Role Role
+
+	// Strict makes Observe* return violations so the caller can drop the
+	// frame. Otherwise violations go to OnViolation and nil is returned.
+	Strict      bool
+	OnViolation func(err error)
+
+	// StopGrace tolerates inbound audio that was already in flight when
+	// this endpoint ended the stream it belonged to.
+	StopGrace time.Duration
+
+	mu        sync.Mutex
+	described bool
+	ready     bool
+	streaming bool
+	asr       asrPhase
+	tts       ttsPhase
+	stoppedAt time.Time
+
+	// ttsText is set from a streamed tts.start until tts.end or tts.stop.
+	ttsText bool
+
+	// audioReported suppresses repeat reports for a run of bad audio.
+	audioReported [2]bool
+}
+
+func NewSession(role Role) *Session {
+	return &Session{Role: role, StopGrace: DefaultStopGrace}
+}
+
+func (s *Session) ObserveFrame(dir Direction, f *Frame) error {
+	switch f.Type {
+	case FrameTypeJSON:
+		t, err := ParseEventType(f.Payload)
+		if err != nil {
+			return err
+		}
+		return s.observe(dir, t, t == EventTTSStart && streamed(f.Payload))
+	case FrameTypeAudio:
+		return s.ObserveAudio(dir)
+	default:
+		return nil
+	}
+}
+
+// Observe is ObserveEvent for a decoded event. Unlike ObserveEvent it sees
+// whether a tts.start is streamed, which decides if tts.chunk may follow.
+func (s *Session) Observe(dir Direction, ev Event) error {
+	start, ok := ev.(TTSStartEvent)
+	return s.observe(dir, ev.EventType(), ok && start.Stream)
+}
+
+// ObserveEvent observes an event by type alone; a tts.start is taken to be
+// not streamed.
+func (s *Session) ObserveEvent(dir Direction, t EventType) error {
+	return s.observe(dir, t, false)
+}
+
+func streamed(payload []byte) bool {
+	var start struct {
+		Stream bool `json:"stream"`
+	}
+	return json.Unmarshal(payload, &start) == nil && start.Stream
+}
+
+func (s *Session) observe(dir Direction, t EventType, stream bool) error {
+	s.mu.Lock()
+	s.audioReported = [2]bool{}
+	var verr error
+	err := s.event(s.fromClient(dir), t)
+	if err != nil {
+		verr = &ViolationError{Direction: dir, Event: t, State: s.state(), Err: err}
+	}
+	if err == nil || !s.Strict {
+		s.applyEvent(dir, t, stream)
+	}
+	s.mu.Unlock()
+	return s.report(verr)
+}
+
+func (s *Session) ObserveAudio(dir Direction) error {
+	s.mu.Lock()
+	var verr error
+	if err := s.audio(dir); err != nil {
+		if !s.Strict && s.audioReported[dir] {
+			s.mu.Unlock()
+			return nil
+		}
+		s.audioReported[dir] = true
+		verr = &ViolationError{Direction: dir, Event: EventAudio, State: s.state(), Err: err}
+	} else {
+		s.audioReported[dir] = false
+	}
+	s.mu.Unlock()
+	return s.report(verr)
+}
+
+func (s *Session) report(verr error) error {
+	if verr == nil {
+		return nil
+	}
+	if s.Strict {
+		return verr
+	}
+	if s.OnViolation != nil {
+		s.OnViolation(verr)
+	}
+	return nil
+}
+
+func (s *Session) fromClient(dir Direction) bool {
+	return (s.Role == RoleClient) == (dir == Outbound)
+}
+
+func (s *Session) event(fromClient bool, t EventType) error {
+	switch t {
+	case EventError:
+		return nil
+	case EventDescribe:
+		if !fromClient {
+			return ErrWrongDirection
+		}
+		return nil
+	case EventReady:
+		if fromClient {
+			return ErrWrongDirection
+		}
+		if !s.described {
+			return ErrUnexpectedEvent
+		}
+		return nil
+	}
+
+	from := senderOf(t)
+	if from == senderUnknown {
+		// Unknown events MUST be ignored, so they are never violations.
+		return nil
+	}
+	if !s.ready {
+		return ErrNotReady
+	}
+	if (from == senderClient && !fromClient) || (from == senderServer && fromClient) {
+		return ErrWrongDirection
+	}
+
+	switch t {
+	case EventStop:
+		if !s.streaming {
+			return ErrUnexpectedEvent
+		}
+	case EventASRStop:
+		if s.asr != asrActive {
+			return ErrUnexpectedEvent
+		}
+	case EventASRPartial:
+		if s.asr == asrIdle {
+			return ErrUnexpectedEvent
+		}
+	case EventASRResult:
+		if s.asr == asrIdle {
+			return ErrUnexpectedEvent
+		}
+	case EventTTSDone:
+		if s.tts != ttsSpeaking && s.tts != ttsStopped {
+			return ErrUnexpectedEvent
+		}
+	case EventTTSChunk, EventTTSEnd:
+		if !s.ttsText {
+			return ErrUnexpectedEvent
+		}
+	}
+	return nil
+}
+
+type sender int
+
+const (
+	senderUnknown sender = iota
+	senderAny
+	senderClient
+	senderServer
+)
+
+func senderOf(t EventType) sender {
+	switch t {
+	case EventStart, EventStop, EventASRStart, EventASRStop, EventTTSStart, EventTTSStop, EventTTSVoices,
+		EventTTSChunk, EventTTSEnd:
+		return senderClient
+	case EventASRPartial, EventASRResult, EventASRError, EventTTSReady, EventTTSDone, EventTTSError, EventTTSVoicesResult:
+		return senderServer
+	case EventSatelliteHello, EventSatelliteState, EventWakeDetected, EventWakeReset, EventVADStart, EventVADStop:
+		return senderAny
+	default:
+		return senderUnknown
+	}
+}
+
+func (s *Session) applyEvent(dir Direction, t EventType, stream bool) {
+	local := dir == Outbound
+	switch t {
+	case EventDescribe:
+		s.described = true
+	case EventReady:
+		s.ready = true
+	case EventStart:
+		s.streaming = true
+	case EventStop:
+		s.streaming = false
+		s.markStopped(local)
+	case EventASRStart:
+		s.asr = asrActive
+	case EventASRStop:
+		s.asr = asrFinishing
+		s.markStopped(local)
+	case EventASRResult, EventASRError:
+		if s.asr == asrActive {
+			s.markStopped(local)
+		}
+		s.asr = asrIdle
+	case EventTTSStart:
+		s.tts = ttsRequested
+		s.ttsText = stream
+	case EventTTSEnd:
+		s.ttsText = false
+	case EventTTSReady:
+		s.tts = ttsSpeaking
+	case EventTTSStop:
+		if s.tts != ttsIdle {
+			s.tts = ttsStopped
+		}
+		s.ttsText = false
+		s.markStopped(local)
+	case EventTTSDone, EventTTSError:
+		s.tts = ttsIdle
+	}
+}
+
+func (s *Session) markStopped(local bool) {
+	if local {
+		s.stoppedAt = time.Now()
+	}
+}
+
+func (s *Session) audio(dir Direction) error {
+	var err error
+	if s.fromClient(dir) {
+		if s.asr != asrActive {
+			err = ErrAudioNotAllowed
+		}
+	} else if !s.streaming && s.tts != ttsSpeaking {
+		err = ErrAudioNotAllowed
+		if s.tts == ttsStopped {
+			err = ErrAudioAfterTTSStop
+		}
+	}
+	if !s.ready {
+		err = ErrNotReady
+	}
+
+	if err != nil && dir == Inbound && !s.stoppedAt.IsZero() && time.Since(s.stoppedAt) < s.StopGrace {
+		return nil
+	}
+	return err
+}
+
+func (s *Session) state() string {
+	switch {
+	case !s.described:
+		return "connected"
+	case !s.ready:
+		return "described"
+	}
+	state := "ready"
+	if s.streaming {
+		state += "+streaming"
+	}
+	switch s.asr {
+	case asrActive:
+		state += "+asr"
+	case asrFinishing:
+		state += "+asr-finishing"
+	}
+	switch s.tts {
+	case ttsRequested:
+		state += "+tts-requested"
+	case ttsSpeaking:
+		state += "+tts"
+	case ttsStopped:
+		state += "+tts-stopped"
+	}
+	return state
+}
@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+type step struct {
+	dir Direction
+	ev  EventType
+}
+
+// evTTSStream stands for a tts.start with stream set.
+const evTTSStream EventType = "test.tts.start+stream"
+
+func run(s *Session, steps []step) error {
+	for _, st := range steps {
+		var err error
+		if st.ev == EventAudio {
+			err = s.ObserveAudio(st.dir)
+		} else if st.ev == evTTSStream {
+			err = s.Observe(st.dir, TTSStartEvent{Type: EventTTSStart, Stream: true})
+		} else {
+			err = s.ObserveEvent(st.dir, st.ev)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSessionValidFlows(t *testing.T) {
+	s := NewSession(RoleServer)
+	s.Strict = true
+
+	err := run(s, []step{
+		{Inbound, EventDescribe},
+		{Outbound, EventReady},
+		{Inbound, EventSatelliteHello},
+		{Inbound, EventASRStart},
+		{Inbound, EventAudio},
+		{Outbound, EventASRPartial},
+		{Inbound, EventASRStop},
+		{Outbound, EventASRResult},
+		{Inbound, EventTTSVoices},
+		{Outbound, EventTTSVoicesResult},
+		{Inbound, evTTSStream},
+		{Outbound, EventTTSReady},
+		{Outbound, EventAudio},
+		{Inbound, EventTTSChunk},
+		{Outbound, EventAudio},
+		{Inbound, EventTTSEnd},
+		{Outbound, EventTTSDone},
+		{Inbound, EventStart},
+		{Outbound, EventAudio},
+		{Inbound, EventStop},
+		{Inbound, "vendor.custom"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionViolations(t *testing.T) {
+	handshake := []step{{Outbound, EventDescribe}, {Inbound, EventReady}}
+
+	cases := []struct {
+		name  string
+		steps []step
+		want  error
+	}{
+		{"start before ready", []step{{Outbound, EventStart}}, ErrNotReady},
+		{"ready without describe", []step{{Inbound, EventReady}}, ErrUnexpectedEvent},
+		{"server sends asr.start", append(handshake, step{Inbound, EventASRStart}), ErrWrongDirection},
+		{"audio before asr.start", append(handshake, step{Outbound, EventAudio}), ErrAudioNotAllowed},
+		{"audio after asr.stop", append(handshake,
+			step{Outbound, EventASRStart}, step{Outbound, EventASRStop}, step{Outbound, EventAudio}), ErrAudioNotAllowed},
+		{"asr.result without asr.start", append(handshake, step{Inbound, EventASRResult}), ErrUnexpectedEvent},
+		{"tts.chunk after tts.end", append(handshake,
+			step{Outbound, evTTSStream}, step{Outbound, EventTTSEnd}, step{Outbound, EventTTSChunk}), ErrUnexpectedEvent},
+		{"tts.chunk without stream", append(handshake,
+			step{Outbound, EventTTSStart}, step{Outbound, EventTTSChunk}), ErrUnexpectedEvent},
+	}
+	for _, c := range cases {
+		s := NewSession(RoleClient)
+		s.Strict = true
+		err := run(s, c.steps)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestSessionAudioAfterTTSStop(t *testing.T) {
+	s := NewSession(RoleServer)
+	s.Strict = true
+
+	err := run(s, []step{
+		{Inbound, EventDescribe},
+		{Outbound, EventReady},
+		{Inbound, EventTTSStart},
+		{Outbound, EventTTSReady},
+		{Outbound, EventAudio},
+		{Inbound, EventTTSStop},
+		{Outbound, EventAudio},
+	})
+	var verr *ViolationError
+	if !errors.As(err, &verr) || !errors.Is(err, ErrAudioAfterTTSStop) {
+		t.Fatalf("got %v, want ErrAudioAfterTTSStop", err)
+	}
+	if verr.Direction != Outbound || verr.Event != EventAudio {
+		t.Fatalf("unexpected violation: %+v", verr)
+	}
+}
+
+func TestSessionLenientReports(t *testing.T) {
+	s := NewSession(RoleServer)
+	var got []error
+	s.OnViolation = func(err error) { got = append(got, err) }
+
+	if err := s.ObserveEvent(Inbound, EventStart); err != nil {
+		t.Fatalf("lenient session returned %v", err)
+	}
+	if len(got) != 1 || !errors.Is(got[0], ErrNotReady) {
+		t.Fatalf("got %v, want one ErrNotReady", got)
+	}
+}
+
+func TestSessionStreamedFrame(t *testing.T) {
+	s := NewSession(RoleServer)
+	s.Strict = true
+	if err := run(s, []step{{Inbound, EventDescribe}, {Outbound, EventReady}}); err != nil {
+		t.Fatal(err)
+	}
+	frame := func(payload string) *Frame {
+		return &Frame{Version: VersionByte, Type: FrameTypeJSON, Length: uint32(len(payload)), Payload: []byte(payload)}
+	}
+	if err := s.ObserveFrame(Inbound, frame(`{"type":"tts.start","text":"Hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ObserveFrame(Inbound, frame(`{"type":"tts.chunk","text":" there"}`)); !errors.Is(err, ErrUnexpectedEvent) {
+		t.Fatalf("chunk after plain tts.start: got %v", err)
+	}
+	if err := s.ObserveFrame(Inbound, frame(`{"type":"tts.start","stream":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ObserveFrame(Inbound, frame(`{"type":"tts.chunk","text":" there"}`)); err != nil {
+		t.Fatalf("chunk after streamed tts.start: %v", err)
+	}
+}
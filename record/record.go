@@ -0,0 +1,212 @@
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"ion/protocol"
+)
+
+// A recording starts with magic, a format version and the role of the
+// endpoint that made it. Each entry is a direction byte, the monotonic
+// offset since the start in nanoseconds (i64 LE) and the frame exactly as
+// encoded on the wire.
+const (
+	magic         = "IONREC"
+	formatVersion = 1
+	headerSize    = len(magic) + 2
+	entryHeader   = 9
+)
+
+const maxRecordedFrame = 16 << 20
+
+var ErrBadRecording = errors.New("record: not an ION recording")
+
+type Entry struct {
+	Offset    time.Duration
+	Direction protocol.Direction
+	Frame     *protocol.Frame
+}
+
+// Sender reports which role sent the entry, given the recording's role.
+func (e Entry) Sender(recorder protocol.Role) protocol.Role {
+	if e.Direction == protocol.Outbound {
+		return recorder
+	}
+	if recorder == protocol.RoleClient {
+		return protocol.RoleServer
+	}
+	return protocol.RoleClient
+}
+
+type Writer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	start  time.Time
+	buf    []byte
+	err    error
+}
+
+func NewWriter(w io.Writer, role protocol.Role) (*Writer, error) {
+	hdr := append([]byte(magic), formatVersion, byte(role))
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, start: time.Now()}, nil
+}
+
+func Create(path string, role protocol.Role) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, role)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+func (w *Writer) WriteFrame(dir protocol.Direction, f *protocol.Frame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	offset := time.Since(w.start)
+
+	b := w.buf[:0]
+	b = append(b, byte(dir))
+	b = binary.LittleEndian.AppendUint64(b, uint64(offset))
+	b = append(b, f.Version, f.Type)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(f.Payload)))
+	b = append(b, f.Payload...)
+	w.buf = b
+
+	if _, err := w.w.Write(b); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// Tap records a frame and keeps the first error for Close. Its signature
+// matches the frame taps of the server and client packages.
+func (w *Writer) Tap(dir protocol.Direction, f *protocol.Frame) {
+	_ = w.WriteFrame(dir, f)
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.err
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+		w.closer = nil
+	}
+	if w.err == nil {
+		w.err = os.ErrClosed
+	}
+	return err
+}
+
+type Reader struct {
+	Role protocol.Role
+
+	r      *bufio.Reader
+	frames *protocol.Reader
+	hdr    [entryHeader]byte
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadRecording, err)
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return nil, ErrBadRecording
+	}
+	if v := hdr[len(magic)]; v != formatVersion {
+		return nil, fmt.Errorf("%w: format version %d", ErrBadRecording, v)
+	}
+
+	frames := protocol.NewReader(br)
+	frames.SetLimit(protocol.FrameTypeJSON, maxRecordedFrame)
+	frames.SetLimit(protocol.FrameTypeAudio, maxRecordedFrame)
+	frames.MaxLength = maxRecordedFrame
+
+	return &Reader{
+		Role:   protocol.Role(hdr[len(magic)+1]),
+		r:      br,
+		frames: frames,
+	}, nil
+}
+
+// Next returns io.EOF after the last complete entry.
+func (r *Reader) Next() (Entry, error) {
+	if _, err := io.ReadFull(r.r, r.hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return Entry{}, err
+	}
+	f, err := r.frames.ReadFrame()
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return Entry{}, err
+	}
+	return Entry{
+		Direction: protocol.Direction(r.hdr[0]),
+		Offset:    time.Duration(binary.LittleEndian.Uint64(r.hdr[1:])),
+		Frame:     f,
+	}, nil
+}
+
+type Recording struct {
+	Role    protocol.Role
+	Entries []Entry
+}
+
+// Load reads a whole recording. A truncated final entry, as left by a
+// process that was killed mid-write, is dropped.
+func Load(r io.Reader) (*Recording, error) {
+	rd, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recording{Role: rd.Role}
+	for {
+		e, err := rd.Next()
+		if err == io.EOF {
+			return rec, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec.Entries = append(rec.Entries, e)
+	}
+}
+
+func Open(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
@@ -0,0 +1,105 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"ion/protocol"
+	"ion/server"
+)
+
+func newTestServer() *server.Server {
+	srv := server.New()
+	srv.Handle(protocol.EventDescribe, func(s *server.Session, _ protocol.Event) error {
+		return s.Send(protocol.ReadyEvent{Type: protocol.EventReady, Protocol: "ion", SampleRate: 16000, Channels: 1, Format: "s16le"})
+	})
+	srv.Handle(protocol.EventASRStop, func(s *server.Session, _ protocol.Event) error {
+		return s.Send(protocol.ASRResultEvent{Type: protocol.EventASRResult, Text: "ok"})
+	})
+	return srv
+}
+
+func TestRecordRoundtrip(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf, protocol.RoleServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"type":"describe"}`)
+	w.Tap(protocol.Inbound, &protocol.Frame{Version: protocol.VersionByte, Type: protocol.FrameTypeJSON, Length: uint32(len(payload)), Payload: payload})
+	w.Tap(protocol.Outbound, &protocol.Frame{Version: protocol.VersionByte, Type: protocol.FrameTypeAudio, Length: 2, Payload: []byte{1, 2}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A truncated trailing entry is dropped.
+	buf.Write([]byte{1, 0, 0})
+
+	rec, err := Load(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Role != protocol.RoleServer || len(rec.Entries) != 2 {
+		t.Fatalf("got role %v with %d entries", rec.Role, len(rec.Entries))
+	}
+	if e := rec.Entries[0]; e.Direction != protocol.Inbound || !bytes.Equal(e.Frame.Payload, payload) {
+		t.Fatalf("unexpected first entry: %+v", e)
+	}
+	if e := rec.Entries[1]; e.Sender(rec.Role) != protocol.RoleServer || e.Offset < rec.Entries[0].Offset {
+		t.Fatalf("unexpected second entry: %+v", e)
+	}
+}
+
+func TestReplayAgainstServer(t *testing.T) {
+	srv := newTestServer()
+
+	// Record a session on the server side.
+	buf := new(bytes.Buffer)
+	rw, err := NewWriter(buf, protocol.RoleServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.OnConnect = func(s *server.Session) { s.SetTap(rw.Tap) }
+
+	cc, sc := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		srv.ServeConn(context.Background(), sc)
+		close(done)
+	}()
+	exchange := func(ev protocol.Event, reply bool) {
+		t.Helper()
+		if err := protocol.WriteJSON(cc, ev); err != nil {
+			t.Fatal(err)
+		}
+		if reply {
+			if _, err := protocol.ReadFrame(cc); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	exchange(protocol.DescribeEvent{Type: protocol.EventDescribe}, true)
+	exchange(protocol.ASRStartEvent{Type: protocol.EventASRStart}, false)
+	exchange(protocol.ASRStopEvent{Type: protocol.EventASRStop}, true)
+	cc.Close()
+	<-done
+
+	rec, err := Load(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay the client half against a fresh connection.
+	srv.OnConnect = nil
+	cc, sc = net.Pipe()
+	defer cc.Close()
+	go srv.ServeConn(context.Background(), sc)
+
+	p := &Player{As: protocol.RoleClient, Speed: 0, SyncTimeout: time.Second}
+	if err := p.Play(context.Background(), rec, cc); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+package record
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"ion/protocol"
+)
+
+const DefaultSyncTimeout = 10 * time.Second
+
+// Events whose timing or presence depends on the recogniser; waiting for
+// them would make replays flaky.
+var defaultIgnore = []protocol.EventType{
+	protocol.EventASRPartial,
+	protocol.EventVADStart,
+	protocol.EventVADStop,
+}
+
+// Player replays one side of a recording against a live peer. Frames sent
+// by the As role are written with their recorded spacing; JSON events the
+// other role sent are awaited from the peer before replay continues, which
+// keeps request/response ordering deterministic.
+type Player struct {
+	As protocol.Role
+
+	// Speed scales the recorded timing; 2 plays twice as fast. Zero or
+	// less sends frames as fast as possible.
+	Speed float64
+
+	SyncTimeout time.Duration
+
+	// Ignore lists peer events that are not waited for. Nil means
+	// asr.partial, vad.start and vad.stop.
+	Ignore []protocol.EventType
+
+	// OnFrame observes live traffic in both directions.
+	OnFrame func(dir protocol.Direction, f *protocol.Frame)
+}
+
+func (p *Player) Play(ctx context.Context, rec *Recording, rw io.ReadWriter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	syncTimeout := p.SyncTimeout
+	if syncTimeout <= 0 {
+		syncTimeout = DefaultSyncTimeout
+	}
+	ignore := p.Ignore
+	if ignore == nil {
+		ignore = defaultIgnore
+	}
+
+	events := make(chan protocol.EventType, 64)
+	var readErr error
+	go func() {
+		defer close(events)
+		readErr = p.readPeer(ctx, rw, events)
+	}()
+
+	if len(rec.Entries) == 0 {
+		return nil
+	}
+	anchorLive := time.Now()
+	anchorRec := rec.Entries[0].Offset
+
+	for i, e := range rec.Entries {
+		if e.Sender(rec.Role) == p.As {
+			if p.Speed > 0 {
+				due := anchorLive.Add(time.Duration(float64(e.Offset-anchorRec) / p.Speed))
+				if err := sleepUntil(ctx, due); err != nil {
+					return err
+				}
+			}
+			if err := protocol.WriteFrame(rw, e.Frame); err != nil {
+				return fmt.Errorf("entry %d: %w", i, err)
+			}
+			if p.OnFrame != nil {
+				p.OnFrame(protocol.Outbound, e.Frame)
+			}
+			continue
+		}
+
+		if e.Frame.Type != protocol.FrameTypeJSON {
+			continue
+		}
+		want, err := protocol.ParseEventType(e.Frame.Payload)
+		if err != nil || contains(ignore, want) {
+			continue
+		}
+		if err := awaitEvent(ctx, events, want, syncTimeout); err != nil {
+			if err == io.EOF && readErr != nil {
+				err = readErr
+			}
+			return fmt.Errorf("entry %d: waiting for %s: %w", i, want, err)
+		}
+		anchorLive, anchorRec = time.Now(), e.Offset
+	}
+	return nil
+}
+
+func (p *Player) readPeer(ctx context.Context, r io.Reader, events chan<- protocol.EventType) error {
+	rd := protocol.NewReader(bufio.NewReader(r))
+	rd.SetLimit(protocol.FrameTypeAudio, maxRecordedFrame)
+	for {
+		f, err := rd.ReadFrame()
+		if err != nil {
+			return err
+		}
+		if p.OnFrame != nil {
+			p.OnFrame(protocol.Inbound, f)
+		}
+		if f.Type != protocol.FrameTypeJSON {
+			continue
+		}
+		t, err := protocol.ParseEventType(f.Payload)
+		if err != nil {
+			continue
+		}
+		select {
+		case events <- t:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func awaitEvent(ctx context.Context, events <-chan protocol.EventType, want protocol.EventType, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case t, ok := <-events:
+			if !ok {
+				return io.EOF
+			}
+			if t == want {
+				return nil
+			}
+		case <-timer.C:
+			return fmt.Errorf("no %s within %s", want, timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func contains(list []protocol.EventType, t protocol.EventType) bool {
+	for _, v := range list {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
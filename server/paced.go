@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ion/protocol"
+)
+
+// PacedWriter sends audio on a Session in real time. The first Lead of
+// audio goes out as fast as the peer takes it, so the client can buffer;
+// after that each frame is due when the audio before it, less Lead, has
+// had time to play. Deadlines come from a monotonic clock, so sleeps that
+// overrun do not accumulate into drift.
+//
+// Writes block while the connection does, which is the backpressure from a
+// slow client. When that leaves the client short of audio, the schedule
+// restarts from the current time rather than bursting to catch up. The
+// restart sends Lead at once again to refill the client's buffer, so a
+// writer that keeps stalling re-bursts Lead after every stall, never the
+// audio it fell behind by.
+type PacedWriter struct {
+	sess           *Session
+	bytesPerSecond int
+	lead           time.Duration
+
+	start time.Time
+	sent  time.Duration // audio sent since start
+
+	// Underruns counts the times the writer fell behind real time.
+	Underruns int
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewPacedWriter(s *Session, format protocol.AudioFormat, lead time.Duration) (*PacedWriter, error) {
+	bps := format.SampleRate * format.Channels * format.Format.BytesPerSample()
+	if bps <= 0 {
+		return nil, errors.New("server: paced writer needs a valid audio format")
+	}
+	return &PacedWriter{sess: s, bytesPerSecond: bps, lead: lead, now: time.Now, sleep: sleep}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Write waits until pcm is due, then sends it as one audio frame. It
+// returns ctx.Err() as soon as ctx is done, without sending.
+func (w *PacedWriter) Write(ctx context.Context, pcm []byte) error {
+	now := w.now()
+	if w.start.IsZero() {
+		w.start = now
+	}
+	ahead := w.sent - now.Sub(w.start)
+	if ahead < 0 {
+		w.Underruns++
+		w.start = now.Add(-w.sent)
+	} else if wait := ahead - w.lead; wait > 0 {
+		if err := w.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := w.sess.SendAudio(pcm); err != nil {
+		return err
+	}
+	w.sent += time.Duration(len(pcm)) * time.Second / time.Duration(w.bytesPerSecond)
+	return nil
+}
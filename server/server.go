@@ -0,0 +1,267 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"ion/protocol"
+)
+
+// Handlers run on the connection's read loop. Events are decoded through the
+// protocol registry, so ev holds the concrete struct for its type.
+type HandlerFunc func(s *Session, ev protocol.Event) error
+
+// The pcm buffer is reused once the handler returns and must be copied if
+// retained.
+type AudioHandlerFunc func(s *Session, pcm []byte) error
+
+type Server struct {
+	// OnConnect runs before the first frame is read; OnDisconnect runs
+	// after the session context has been cancelled.
+	OnConnect    func(s *Session)
+	OnDisconnect func(s *Session)
+
+	ErrorLog *log.Logger
+
+	// Limits overrides the default per-frame-type payload limits of
+	// protocol.NewReader. SkipOversize drops oversized frames instead of
+	// closing the connection.
+	Limits       map[byte]uint32
+	SkipOversize bool
+
+	// Strict drops frames that violate the session model and answers them
+	// with an error event. Violations are always passed to OnViolation,
+	// which logs them by default.
+	Strict      bool
+	OnViolation func(s *Session, err error)
+
+	// AudioWriteTimeout, if set, bounds each audio frame write on
+	// connections that support write deadlines. A peer that stops reading
+	// for longer is disconnected instead of holding up control events.
+	AudioWriteTimeout time.Duration
+
+	mu       sync.RWMutex
+	handlers map[protocol.EventType]HandlerFunc
+	audio    AudioHandlerFunc
+}
+
+func New() *Server {
+	return &Server{handlers: make(map[protocol.EventType]HandlerFunc)}
+}
+
+func (srv *Server) Handle(t protocol.EventType, h HandlerFunc) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if h == nil {
+		delete(srv.handlers, t)
+		return
+	}
+	srv.handlers[t] = h
+}
+
+func (srv *Server) HandleAudio(h AudioHandlerFunc) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.audio = h
+}
+
+func (srv *Server) Serve(ctx context.Context, ln net.Listener) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = ln.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			continue
+		}
+		go func() {
+			_ = srv.ServeConn(ctx, c)
+		}()
+	}
+}
+
+// ServeConn runs a session on c and closes it when the session ends.
+func (srv *Server) ServeConn(ctx context.Context, c net.Conn) error {
+	return srv.serve(ctx, c, c, c.Close)
+}
+
+// ServeStream runs a session over a pair of streams such as stdin/stdout.
+// The streams are not closed.
+func (srv *Server) ServeStream(ctx context.Context, in io.Reader, out io.Writer) error {
+	return srv.serve(ctx, in, out, nil)
+}
+
+func (srv *Server) serve(ctx context.Context, in io.Reader, out io.Writer, closer func() error) error {
+	sess := newSession(ctx, out, closer)
+	sess.proto = srv.newProtocolSession(sess)
+	sess.audioTimeout = srv.AudioWriteTimeout
+	defer func() {
+		sess.Close()
+		if srv.OnDisconnect != nil {
+			srv.OnDisconnect(sess)
+		}
+	}()
+
+	if srv.OnConnect != nil {
+		srv.OnConnect(sess)
+	}
+
+	reader := srv.newReader(in)
+	for {
+		f, err := reader.ReadFrame()
+		if err != nil {
+			if sess.Context().Err() != nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			var tooLarge *protocol.FrameTooLargeError
+			if errors.As(err, &tooLarge) && tooLarge.Skipped {
+				srv.logf("skipped frame: %v", err)
+				continue
+			}
+			srv.logf("read frame: %v", err)
+			srv.reject(sess, err)
+			return err
+		}
+
+		sess.tapFrame(protocol.Inbound, f)
+		err = srv.dispatch(sess, f)
+		reader.Release(f)
+		if err != nil {
+			srv.logf("handle frame: %v", err)
+			srv.reject(sess, err)
+			return err
+		}
+	}
+}
+
+func (srv *Server) newProtocolSession(sess *Session) *protocol.Session {
+	proto := protocol.NewSession(protocol.RoleServer)
+	proto.Strict = srv.Strict
+	proto.OnViolation = func(err error) {
+		if !sess.deferViolation(err) {
+			srv.violation(sess, err)
+		}
+	}
+	sess.onViolation = func(err error) {
+		srv.violation(sess, err)
+	}
+	return proto
+}
+
+func (srv *Server) violation(sess *Session, err error) {
+	if srv.OnViolation != nil {
+		srv.OnViolation(sess, err)
+		return
+	}
+	srv.logf("protocol violation: %v", err)
+}
+
+// rejectAudio reports only the first frame of a run of rejected audio so a
+// misbehaving peer does not get an error event per frame.
+func (srv *Server) rejectAudio(sess *Session, err error) error {
+	if sess.audioRejected {
+		return nil
+	}
+	sess.audioRejected = true
+	srv.violation(sess, err)
+	return sess.Send(protocol.ErrorEvent{Type: protocol.EventError, Message: err.Error()})
+}
+
+func (srv *Server) newReader(in io.Reader) *protocol.FrameReader {
+	reader := protocol.NewFrameReader(bufio.NewReader(in))
+	for t, max := range srv.Limits {
+		reader.SetLimit(t, max)
+	}
+	reader.SkipOversize = srv.SkipOversize
+	return reader
+}
+
+func (srv *Server) dispatch(sess *Session, f *protocol.Frame) error {
+	switch f.Type {
+	case protocol.FrameTypeJSON:
+		t, err := protocol.ParseEventType(f.Payload)
+		if err != nil {
+			return err
+		}
+		if err := sess.proto.ObserveFrame(protocol.Inbound, f); err != nil {
+			srv.violation(sess, err)
+			return sess.Send(protocol.ErrorEvent{Type: protocol.EventError, Message: err.Error()})
+		}
+		srv.mu.RLock()
+		h := srv.handlers[t]
+		srv.mu.RUnlock()
+		if h == nil {
+			return nil
+		}
+		ev, err := protocol.DecodeEvent(f.Payload)
+		if err != nil {
+			return err
+		}
+		return h(sess, ev)
+	case protocol.FrameTypeAudio:
+		if err := sess.proto.ObserveAudio(protocol.Inbound); err != nil {
+			return srv.rejectAudio(sess, err)
+		}
+		sess.audioRejected = false
+		srv.mu.RLock()
+		h := srv.audio
+		srv.mu.RUnlock()
+		if h == nil {
+			return nil
+		}
+		return h(sess, f.Payload)
+	default:
+		return nil
+	}
+}
+
+// reject tells the peer why the connection is being closed when the cause
+// is a protocol violation rather than an I/O failure.
+func (srv *Server) reject(sess *Session, err error) {
+	if !isProtocolError(err) {
+		return
+	}
+	_ = sess.Send(protocol.ErrorEvent{Type: protocol.EventError, Message: err.Error()})
+}
+
+func isProtocolError(err error) bool {
+	for _, target := range []error{
+		protocol.ErrUnsupportedVersion,
+		protocol.ErrUnknownFrameType,
+		protocol.ErrFrameTooLarge,
+		protocol.ErrMalformedJSON,
+		protocol.ErrMissingType,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (srv *Server) logf(format string, args ...any) {
+	if srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,429 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"ion/protocol"
+)
+
+func writeEvent(t *testing.T, c net.Conn, ev protocol.Event) {
+	t.Helper()
+	data, err := protocol.Encode(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = protocol.WriteFrame(c, &protocol.Frame{
+		Version: protocol.VersionByte,
+		Type:    protocol.FrameTypeJSON,
+		Length:  uint32(len(data)),
+		Payload: data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerDispatch(t *testing.T) {
+	srv := New()
+	srv.Handle(protocol.EventDescribe, func(s *Session, _ protocol.Event) error {
+		return s.Send(protocol.ReadyEvent{Type: protocol.EventReady, Protocol: "ion"})
+	})
+
+	disconnected := make(chan struct{})
+	srv.OnDisconnect = func(s *Session) {
+		if s.Context().Err() == nil {
+			t.Error("session context not cancelled on disconnect")
+		}
+		close(disconnected)
+	}
+
+	client, conn := net.Pipe()
+	go srv.ServeConn(context.Background(), conn)
+
+	writeEvent(t, client, protocol.BaseEvent{Type: "x.unknown"})
+	writeEvent(t, client, protocol.BaseEvent{Type: protocol.EventDescribe})
+
+	f, err := protocol.ReadFrame(bufio.NewReader(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ready protocol.ReadyEvent
+	if err := protocol.Decode(f.Payload, &ready); err != nil {
+		t.Fatal(err)
+	}
+	if ready.Type != protocol.EventReady {
+		t.Fatalf("got %q, want ready", ready.Type)
+	}
+
+	client.Close()
+	<-disconnected
+}
+
+func TestServerRejectsUnsupportedVersion(t *testing.T) {
+	srv := New()
+	srv.ErrorLog = log.New(io.Discard, "", 0)
+
+	client, conn := net.Pipe()
+	go srv.ServeConn(context.Background(), conn)
+
+	go client.Write([]byte{0x7f, protocol.FrameTypeJSON, 0, 0, 0, 0})
+
+	f, err := protocol.ReadFrame(bufio.NewReader(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ev protocol.ErrorEvent
+	if err := protocol.Decode(f.Payload, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != protocol.EventError || ev.Message == "" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
+
+func TestServerStrictRejectsAudioBeforeStart(t *testing.T) {
+	srv := New()
+	srv.Strict = true
+	srv.OnViolation = func(*Session, error) {}
+	srv.HandleAudio(func(*Session, []byte) error {
+		t.Error("audio handler called for rejected frame")
+		return nil
+	})
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go srv.ServeConn(context.Background(), conn)
+
+	go protocol.WriteAudio(client, []byte{0, 0})
+
+	f, err := protocol.ReadFrame(bufio.NewReader(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := protocol.DecodeEvent(f.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ev.(protocol.ErrorEvent); !ok {
+		t.Fatalf("got %#v, want error event", ev)
+	}
+}
+
+func TestSessionNegotiate(t *testing.T) {
+	native := protocol.AudioFormat{SampleRate: 16000, Channels: 1, Format: protocol.FormatS16LE}
+	mic := protocol.AudioFormat{SampleRate: 48000, Channels: 2, Format: protocol.FormatS16LE}
+
+	huge := protocol.AudioFormat{SampleRate: 4800007, Channels: 1, Format: protocol.FormatS16LE}
+	wide := protocol.AudioFormat{SampleRate: 48000, Channels: 64, Format: protocol.FormatS16LE}
+	for _, offer := range []protocol.AudioFormat{huge, wide} {
+		srv := New()
+		srv.ErrorLog = log.New(io.Discard, "", 0)
+		srv.Handle(protocol.EventDescribe, func(s *Session, ev protocol.Event) error {
+			_, err := s.Negotiate(ev.(protocol.DescribeEvent), native, protocol.AudioFormat{})
+			return err
+		})
+		client, conn := net.Pipe()
+		go srv.ServeConn(context.Background(), conn)
+		writeEvent(t, client, protocol.DescribeEvent{Type: protocol.EventDescribe, Preferred: &offer})
+		f, err := protocol.ReadFrame(bufio.NewReader(client))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev, _ := protocol.DecodeEvent(f.Payload); ev.EventType() != protocol.EventError {
+			t.Fatalf("%v accepted by a converting server: got %#v", offer, ev)
+		}
+		client.Close()
+	}
+
+	for _, convert := range []bool{true, false} {
+		srv := New()
+		srv.ErrorLog = log.New(io.Discard, "", 0)
+		formats := make(chan protocol.AudioFormat, 1)
+		srv.Handle(protocol.EventDescribe, func(s *Session, ev protocol.Event) error {
+			supported := []protocol.AudioFormat{native}
+			if convert {
+				supported = append(supported, protocol.AudioFormat{})
+			}
+			_, err := s.Negotiate(ev.(protocol.DescribeEvent), supported...)
+			f, _ := s.Format()
+			formats <- f
+			return err
+		})
+
+		client, conn := net.Pipe()
+		go srv.ServeConn(context.Background(), conn)
+		writeEvent(t, client, protocol.DescribeEvent{Type: protocol.EventDescribe, Preferred: &mic})
+
+		f, err := protocol.ReadFrame(bufio.NewReader(client))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev, err := protocol.DecodeEvent(f.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := <-formats
+		if convert {
+			ready, ok := ev.(protocol.ReadyEvent)
+			if !ok || ready.AudioFormat() != mic || got != mic {
+				t.Fatalf("convert: got %#v, session format %v", ev, got)
+			}
+		} else if _, ok := ev.(protocol.ErrorEvent); !ok || got != (protocol.AudioFormat{}) {
+			t.Fatalf("no convert: got %#v, session format %v", ev, got)
+		}
+		client.Close()
+	}
+}
+
+func testSession(out io.Writer) *Session {
+	s := newSession(context.Background(), out, nil)
+	s.proto = protocol.NewSession(protocol.RoleServer)
+	return s
+}
+
+// fakeClock stands in for the wall clock in PacedWriter: sleeping advances
+// it, and the total time slept is recorded.
+type fakeClock struct {
+	t     time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.t = c.t.Add(d)
+	c.slept += d
+	return nil
+}
+
+func TestPacedWriter(t *testing.T) {
+	format := protocol.AudioFormat{SampleRate: 16000, Channels: 1, Format: protocol.FormatS16LE}
+	w, err := NewPacedWriter(testSession(io.Discard), format, 40*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	w.now, w.sleep = clock.now, clock.sleep
+	chunk := make([]byte, 640) // 20ms
+
+	// Frame k is due at k*20ms less the 40ms lead, so the tenth at 140ms.
+	for i := 0; i < 10; i++ {
+		if err := w.Write(context.Background(), chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if clock.slept != 140*time.Millisecond {
+		t.Errorf("10 frames waited %v, want 140ms", clock.slept)
+	}
+
+	// After a stall the schedule restarts instead of bursting: the lead
+	// goes out at once and the fifth frame is due 40ms later.
+	clock.t = clock.t.Add(300 * time.Millisecond)
+	clock.slept = 0
+	for i := 0; i < 5; i++ {
+		if err := w.Write(context.Background(), chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Underruns != 1 {
+		t.Errorf("got %d underruns, want 1", w.Underruns)
+	}
+	if clock.slept != 40*time.Millisecond {
+		t.Errorf("5 frames after a stall waited %v, want 40ms", clock.slept)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.Write(ctx, chunk); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancel: got %v", err)
+	}
+}
+
+func TestPacedWriterUnderruns(t *testing.T) {
+	format := protocol.AudioFormat{SampleRate: 16000, Channels: 1, Format: protocol.FormatS16LE}
+	w, err := NewPacedWriter(testSession(io.Discard), format, 40*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	w.now, w.sleep = clock.now, clock.sleep
+	chunk := make([]byte, 640) // 20ms
+
+	if err := w.Write(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each stall rebases the schedule: the frames covering the lead and the
+	// one after it go out at once, then pacing resumes every 20ms.
+	want := []time.Duration{0, 0, 0, 20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond}
+	for stall := 1; stall <= 3; stall++ {
+		clock.t = clock.t.Add(time.Duration(stall) * 200 * time.Millisecond)
+		stalled := clock.t
+		for i, due := range want {
+			if err := w.Write(context.Background(), chunk); err != nil {
+				t.Fatal(err)
+			}
+			if at := clock.t.Sub(stalled); at != due {
+				t.Errorf("stall %d: frame %d sent at %v, want %v", stall, i, at, due)
+			}
+		}
+		if w.Underruns != stall {
+			t.Errorf("stall %d: got %d underruns", stall, w.Underruns)
+		}
+	}
+}
+
+func TestPacedWriterCancel(t *testing.T) {
+	format := protocol.AudioFormat{SampleRate: 16000, Channels: 1, Format: protocol.FormatS16LE}
+	w, err := NewPacedWriter(testSession(io.Discard), format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The next frame is an hour away; the real sleep must end as soon as
+	// ctx is done.
+	w.start, w.sent = time.Now(), time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Write(ctx, make([]byte, 640)) }()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancel: got %v", err)
+	}
+}
+
+// blockingWriter holds up its first write until release is closed.
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.started:
+	default:
+		close(w.started)
+		<-w.release
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestSessionControlBeforeAudio(t *testing.T) {
+	out := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	s := testSession(out)
+
+	waiting := make(chan bool, 16)
+	s.outMu.waiting = func(control bool) { waiting <- control }
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); s.SendAudio([]byte{1, 0}) }()
+	<-out.started
+	go func() { defer wg.Done(); s.SendAudio([]byte{2, 0}) }()
+	if <-waiting {
+		t.Fatal("audio writer waited as control")
+	}
+	go func() { defer wg.Done(); s.Send(protocol.TTSDoneEvent{Type: protocol.EventTTSDone}) }()
+	if !<-waiting {
+		t.Fatal("control writer waited as audio")
+	}
+	close(out.release)
+	wg.Wait()
+
+	r := bufio.NewReader(&out.buf)
+	var got []byte
+	for {
+		f, err := protocol.ReadFrame(r)
+		if err != nil {
+			break
+		}
+		got = append(got, f.Type)
+	}
+	want := []byte{protocol.FrameTypeAudio, protocol.FrameTypeJSON, protocol.FrameTypeAudio}
+	if !bytes.Equal(got, want) {
+		t.Errorf("frame order %v, want %v", got, want)
+	}
+}
+
+func TestSessionViolationSends(t *testing.T) {
+	var out bytes.Buffer
+	sess := newSession(context.Background(), &out, nil)
+	srv := &Server{OnViolation: func(s *Session, err error) {
+		if err := s.Send(protocol.ErrorEvent{Type: protocol.EventError, Message: err.Error()}); err != nil {
+			t.Error(err)
+		}
+	}}
+	sess.proto = srv.newProtocolSession(sess)
+
+	// Audio before the handshake is a violation; reporting it must not
+	// deadlock on the write lock SendAudio held while observing it.
+	if err := sess.SendAudio([]byte{0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(&out)
+	var got []byte
+	for {
+		f, err := protocol.ReadFrame(r)
+		if err != nil {
+			break
+		}
+		got = append(got, f.Type)
+	}
+	want := []byte{protocol.FrameTypeAudio, protocol.FrameTypeJSON}
+	if !bytes.Equal(got, want) {
+		t.Errorf("frames %v, want %v", got, want)
+	}
+}
+
+// stalledConn is a connection whose peer never reads: writes block until
+// the write deadline passes.
+type stalledConn struct {
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *stalledConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *stalledConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	d := c.deadline
+	c.mu.Unlock()
+	if d.IsZero() {
+		select {} // a test without a deadline fails by timing out
+	}
+	<-time.After(time.Until(d))
+	return 0, os.ErrDeadlineExceeded
+}
+
+func TestSessionAudioWriteTimeout(t *testing.T) {
+	sess := testSession(&stalledConn{})
+	sess.audioTimeout = time.Millisecond
+	if err := sess.SendAudio([]byte{0, 0}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+	// The frame was cut short, so the session is closed.
+	if err := sess.Send(protocol.TTSDoneEvent{Type: protocol.EventTTSDone}); err != ErrSessionClosed {
+		t.Errorf("send after timeout: got %v, want ErrSessionClosed", err)
+	}
+}
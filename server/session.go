@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ion/protocol"
+)
+
+var ErrSessionClosed = errors.New("server: session closed")
+
+type Session struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	out   io.Writer
+	outMu writeLock
+
+	// Guarded by outMu.
+	violations  []error
+	onViolation func(err error)
+
+	deadline     interface{ SetWriteDeadline(time.Time) error }
+	audioTimeout time.Duration
+
+	proto         *protocol.Session
+	audioRejected bool
+	tap           atomic.Pointer[protocol.Tap]
+
+	closeOnce sync.Once
+	closer    func() error
+
+	format atomic.Pointer[protocol.AudioFormat]
+
+	valueMu sync.Mutex
+	value   any
+}
+
+func newSession(parent context.Context, out io.Writer, closer func() error) *Session {
+	ctx, cancel := context.WithCancel(parent)
+	s := &Session{
+		ctx:    ctx,
+		cancel: cancel,
+		out:    out,
+		closer: closer,
+	}
+	if d, ok := out.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		s.deadline = d
+	}
+	if closer != nil {
+		// Closing the underlying connection unblocks the read loop.
+		go func() {
+			<-ctx.Done()
+			s.closeConn()
+		}()
+	}
+	return s
+}
+
+// Context is cancelled when the peer disconnects or the session is closed.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Protocol returns the session-model tracker fed with every frame sent or
+// received on this session.
+func (s *Session) Protocol() *protocol.Session {
+	return s.proto
+}
+
+// SetTap installs a tap that sees every frame received and sent on the
+// session. Pass nil to remove it.
+func (s *Session) SetTap(tap protocol.Tap) {
+	if tap == nil {
+		s.tap.Store(nil)
+		return
+	}
+	s.tap.Store(&tap)
+}
+
+func (s *Session) tapFrame(dir protocol.Direction, f *protocol.Frame) {
+	if tap := s.tap.Load(); tap != nil {
+		(*tap)(dir, f)
+	}
+}
+
+// Negotiate answers a describe event: it picks a format from supported
+// (see protocol.Negotiate) and sends ready, or sends an error event if the
+// client offered nothing usable. The error is returned either way.
+func (s *Session) Negotiate(describe protocol.DescribeEvent, supported ...protocol.AudioFormat) (protocol.AudioFormat, error) {
+	f, err := protocol.Negotiate(supported, describe)
+	if err != nil {
+		if serr := s.Send(protocol.ErrorEvent{Type: protocol.EventError, Message: err.Error()}); serr != nil {
+			return protocol.AudioFormat{}, serr
+		}
+		return protocol.AudioFormat{}, err
+	}
+	s.format.Store(&f)
+	return f, s.Send(f.Ready())
+}
+
+// Format returns the stream format agreed by Negotiate, if any.
+func (s *Session) Format() (protocol.AudioFormat, bool) {
+	if f := s.format.Load(); f != nil {
+		return *f, true
+	}
+	return protocol.AudioFormat{}, false
+}
+
+func (s *Session) Value() any {
+	s.valueMu.Lock()
+	defer s.valueMu.Unlock()
+	return s.value
+}
+
+func (s *Session) SetValue(v any) {
+	s.valueMu.Lock()
+	defer s.valueMu.Unlock()
+	s.value = v
+}
+
+func (s *Session) Send(ev protocol.Event) error {
+	data, err := protocol.Encode(ev)
+	if err != nil {
+		return err
+	}
+	f := &protocol.Frame{Version: protocol.VersionByte, Type: protocol.FrameTypeJSON, Length: uint32(len(data)), Payload: data}
+	return s.write(f, func() error {
+		return s.proto.Observe(protocol.Outbound, ev)
+	}, func() error {
+		return protocol.WritePayload(s.out, f.Type, data)
+	})
+}
+
+func (s *Session) SendAudio(pcm []byte) error {
+	f := &protocol.Frame{Version: protocol.VersionByte, Type: protocol.FrameTypeAudio, Length: uint32(len(pcm)), Payload: pcm}
+	return s.write(f, func() error {
+		return s.proto.ObserveAudio(protocol.Outbound)
+	}, func() error {
+		return protocol.WritePayload(s.out, f.Type, pcm)
+	})
+}
+
+func (s *Session) WriteFrame(f *protocol.Frame) error {
+	return s.write(f, func() error {
+		return s.proto.ObserveFrame(protocol.Outbound, f)
+	}, func() error {
+		return protocol.WriteFrame(s.out, f)
+	})
+}
+
+// write observes and sends f while holding outMu. Violations raised while
+// observing, and the tap, run after outMu is released so that they may send
+// on the session themselves.
+//
+// A control frame waits for at most the one audio frame being written. If
+// the peer stops reading, that write only ends with the connection, or
+// after the server's AudioWriteTimeout.
+func (s *Session) write(f *protocol.Frame, observe, send func() error) error {
+	s.outMu.lock(f.Type != protocol.FrameTypeAudio)
+	err := s.writeLocked(f, observe, send)
+	violations := s.violations
+	s.violations = nil
+	s.outMu.unlock()
+
+	for _, v := range violations {
+		s.onViolation(v)
+	}
+	if err == nil {
+		s.tapFrame(protocol.Outbound, f)
+	}
+	return err
+}
+
+func (s *Session) writeLocked(f *protocol.Frame, observe, send func() error) error {
+	if s.ctx.Err() != nil {
+		return ErrSessionClosed
+	}
+	if err := observe(); err != nil {
+		return err
+	}
+	if f.Type == protocol.FrameTypeAudio && s.audioTimeout > 0 && s.deadline != nil {
+		_ = s.deadline.SetWriteDeadline(time.Now().Add(s.audioTimeout))
+		defer s.deadline.SetWriteDeadline(time.Time{})
+	}
+	if err := send(); err != nil {
+		// The frame may be half written, so nothing more can follow it.
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+// deferViolation holds a violation raised by an outbound frame, which is
+// observed under outMu, until write releases the lock.
+func (s *Session) deferViolation(err error) bool {
+	var verr *protocol.ViolationError
+	if !errors.As(err, &verr) || verr.Direction != protocol.Outbound {
+		return false
+	}
+	s.violations = append(s.violations, err)
+	return true
+}
+
+func (s *Session) Close() {
+	s.cancel()
+}
+
+func (s *Session) closeConn() {
+	s.closeOnce.Do(func() {
+		_ = s.closer()
+	})
+}
+
+// writeLock serializes writes to the connection. Control frames waiting for
+// it go ahead of audio, so while a slow peer holds up an audio write, events
+// queue behind that one frame instead of behind every pending audio writer.
+// It is not reentrant.
+type writeLock struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	held    bool
+	control int // control writers waiting
+
+	waiting func(control bool) // test hook, called before each wait
+}
+
+func (l *writeLock) lock(control bool) {
+	l.mu.Lock()
+	if l.cond.L == nil {
+		l.cond.L = &l.mu
+	}
+	if control {
+		l.control++
+	}
+	for l.held || (!control && l.control > 0) {
+		if l.waiting != nil {
+			l.waiting(control)
+		}
+		l.cond.Wait()
+	}
+	if control {
+		l.control--
+	}
+	l.held = true
+	l.mu.Unlock()
+}
+
+func (l *writeLock) unlock() {
+	l.mu.Lock()
+	l.held = false
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
@@ -1,61 +1,30 @@
 package transport
 
 import (
-	"bufio"
-	"io"
+	"context"
 	"net"
 
 	"ion/protocol"
+	"ion/server"
 )
 
-func HandleConn(c net.Conn) {
-	defer c.Close()
-
-	in := bufio.NewReader(c)
-	out := bufio.NewWriter(c)
-
-	for {
-		f, err := protocol.ReadFrame(in)
-		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				return
-			}
-			return
-		}
+var readyServer = newReadyServer()
 
-		if f.Type != protocol.FrameTypeJSON {
-			continue
-		}
-
-		var base protocol.BaseEvent
-		if err := protocol.Decode(f.Payload, &base); err != nil {
-			continue
-		}
+func HandleConn(c net.Conn) {
+	_ = readyServer.ServeConn(context.Background(), c)
+}
 
-		if base.Type == protocol.EventDescribe {
-			sendReady(out)
-		}
-	}
+func newReadyServer() *server.Server {
+	srv := server.New()
+	srv.Handle(protocol.EventDescribe, sendReady)
+	return srv
 }
 
-func sendReady(out *bufio.Writer) {
-	ev := protocol.ReadyEvent{
-		Type:       protocol.EventReady,
-		Protocol:   "ion",
+func sendReady(s *server.Session, ev protocol.Event) error {
+	_, err := s.Negotiate(ev.(protocol.DescribeEvent), protocol.AudioFormat{
 		SampleRate: 16000,
 		Channels:   1,
-		Format:     "s16le",
-	}
-
-	b, _ := protocol.Encode(ev)
-
-	frame := &protocol.Frame{
-		Version: protocol.VersionByte,
-		Type:    protocol.FrameTypeJSON,
-		Length:  uint32(len(b)),
-		Payload: b,
-	}
-
-	_ = protocol.WriteFrame(out, frame)
-	_ = out.Flush()
+		Format:     protocol.FormatS16LE,
+	})
+	return err
 }
@@ -0,0 +1,116 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"ion/audio"
+	"ion/audio/wav"
+)
+
+// commandSource runs a synthesizer command with the text on stdin and
+// reads its audio from stdout.
+type commandSource struct {
+	ctx    context.Context
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	r      io.Reader
+	format audio.Format
+	stderr bytes.Buffer
+
+	closed   atomic.Bool
+	waitOnce sync.Once
+	waitErr  error
+}
+
+func startCommand(ctx context.Context, text string, name string, args ...string) (*commandSource, error) {
+	c := &commandSource{ctx: ctx, cmd: exec.CommandContext(ctx, name, args...)}
+	c.cmd.Stdin = strings.NewReader(text + "\n")
+	c.cmd.Stderr = &limitedBuffer{buf: &c.stderr, max: 4096}
+	var err error
+	if c.stdout, err = c.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("tts: %s: %w", name, err)
+	}
+	c.r = c.stdout
+	return c, nil
+}
+
+// readWAVHeader makes the source parse a WAV header from the output and
+// take its format from it.
+func (c *commandSource) readWAVHeader() error {
+	r, err := wav.NewReader(c.stdout)
+	if err != nil {
+		// Closing stdout ends a command still writing, and its exit
+		// status usually explains the bad output better.
+		_ = c.stdout.Close()
+		if werr := c.wait(); werr != nil {
+			err = werr
+		}
+		return err
+	}
+	h := r.Header()
+	c.r = r
+	c.format = audio.Format{SampleRate: h.SampleRate, Channels: h.Channels, Encoding: h.Format}
+	return nil
+}
+
+func (c *commandSource) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF || (err != nil && c.ctx.Err() != nil) {
+		if werr := c.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (c *commandSource) wait() error {
+	c.waitOnce.Do(func() {
+		err := c.cmd.Wait()
+		switch {
+		case c.closed.Load():
+		case c.ctx.Err() != nil:
+			c.waitErr = c.ctx.Err()
+		case err != nil:
+			msg := strings.TrimSpace(c.stderr.String())
+			if msg == "" {
+				c.waitErr = fmt.Errorf("tts: %s: %w", c.cmd.Args[0], err)
+			} else {
+				c.waitErr = fmt.Errorf("tts: %s: %w: %s", c.cmd.Args[0], err, msg)
+			}
+		}
+	})
+	return c.waitErr
+}
+
+func (c *commandSource) Format() audio.Format { return c.format }
+
+// Close stops the command if it is still running.
+func (c *commandSource) Close() error {
+	c.closed.Store(true)
+	_ = c.cmd.Process.Kill()
+	_ = c.stdout.Close()
+	return c.wait()
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	buf *bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
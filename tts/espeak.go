@@ -0,0 +1,124 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ion/audio"
+	"ion/protocol"
+)
+
+// espeakRate is the sample rate espeak-ng synthesizes at.
+const espeakRate = 22050
+
+// The espeak-ng backend runs espeak-ng once per request and reads the WAV
+// it writes to stdout. A request's voice, or else its language, picks the
+// espeak voice; a voice may carry a variant, as in "en-us+f3". Params:
+//
+//	cmd  path to espeak-ng (default "espeak-ng")
+//	wpm  words per minute at rate 1 (default 175)
+type espeak struct {
+	opts Options
+	cmd  string
+	wpm  float64
+
+	mu     sync.Mutex
+	voices []protocol.Voice // cached from espeak-ng --voices
+}
+
+func newEspeak(opts Options) (Synthesizer, error) {
+	wpm, err := strconv.ParseFloat(opts.Param("wpm", "175"), 64)
+	if err != nil {
+		return nil, err
+	}
+	return &espeak{opts: opts, cmd: opts.Param("cmd", "espeak-ng"), wpm: wpm}, nil
+}
+
+func (e *espeak) Synthesize(ctx context.Context, req Request, format audio.Format) (audio.Source, error) {
+	req = req.withDefaults(e.opts)
+	args := []string{"--stdout", "--stdin", "-s", strconv.Itoa(int(e.wpm * req.Rate))}
+	switch {
+	case req.Voice != "":
+		args = append(args, "-v", req.Voice)
+	case req.Language != "":
+		args = append(args, "-v", req.Language)
+	}
+	src, err := startCommand(ctx, req.Text, e.cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := src.readWAVHeader(); err != nil {
+		return nil, err
+	}
+	return convert(src, format)
+}
+
+// Voices lists the voices espeak-ng reports, by language code.
+func (e *espeak) Voices(ctx context.Context) ([]protocol.Voice, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.voices != nil {
+		return e.voices, nil
+	}
+	out, err := exec.CommandContext(ctx, e.cmd, "--voices").Output()
+	if err != nil {
+		return nil, fmt.Errorf("tts: %s --voices: %w", e.cmd, err)
+	}
+	e.voices = parseEspeakVoices(string(out))
+	return e.voices, nil
+}
+
+// checkVoice accepts a listed language code or voice name, with or
+// without a variant.
+func (e *espeak) checkVoice(ctx context.Context, voice string) error {
+	base, _, _ := strings.Cut(voice, "+")
+	voices, err := e.Voices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, v := range voices {
+		if v.ID == base || strings.EqualFold(strings.ReplaceAll(v.Name, " ", "_"), base) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownVoice, voice)
+}
+
+// parseEspeakVoices reads the table printed by espeak-ng --voices:
+//
+//	Pty Language       Age/Gender VoiceName          File                 Other Languages
+//	 5  en-gb           --/M      English_(Great_Britain) gmw/en            (en 2)
+func parseEspeakVoices(out string) []protocol.Voice {
+	voices := []protocol.Voice{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] == "Pty" {
+			continue
+		}
+		v := protocol.Voice{
+			ID:         fields[1],
+			Name:       strings.ReplaceAll(fields[3], "_", " "),
+			Languages:  []string{fields[1]},
+			SampleRate: espeakRate,
+		}
+		if _, g, ok := strings.Cut(fields[2], "/"); ok {
+			switch g {
+			case "M":
+				v.Gender = "male"
+			case "F":
+				v.Gender = "female"
+			}
+		}
+		for _, f := range fields[5:] {
+			if l, ok := strings.CutPrefix(f, "("); ok && l != fields[1] {
+				v.Languages = append(v.Languages, l)
+			}
+		}
+		voices = append(voices, v)
+	}
+	return voices
+}
@@ -0,0 +1,170 @@
+package tts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ion/audio"
+	"ion/protocol"
+)
+
+// The piper backend runs piper once per request with --output_raw, which
+// writes 16-bit mono PCM at the voice's sample rate. Params:
+//
+//	cmd          path to piper (default "piper")
+//	model        voice model used when a request names no voice
+//	voices_dir   directory searched for VOICE.onnx (default ".")
+//	sample_rate  output rate, if the model has no .onnx.json next to it
+//	speaker      speaker id for multi-speaker models
+//
+// A request voice is a catalogue ID such as "en_US-lessac-medium": a model
+// in voices_dir, or the basename of model. Model paths only come from the
+// model param, never from a request.
+type piper struct {
+	opts Options
+	cmd  string
+}
+
+func newPiper(opts Options) (Synthesizer, error) {
+	return &piper{opts: opts, cmd: opts.Param("cmd", "piper")}, nil
+}
+
+// piperConfig is the part of a model's .onnx.json that matters here.
+type piperConfig struct {
+	Audio struct {
+		SampleRate int    `json:"sample_rate"`
+		Quality    string `json:"quality"`
+	} `json:"audio"`
+	Language struct {
+		Code string `json:"code"`
+	} `json:"language"`
+	Dataset     string `json:"dataset"`
+	NumSpeakers int    `json:"num_speakers"`
+}
+
+func loadPiperConfig(model string) piperConfig {
+	var config piperConfig
+	if data, err := os.ReadFile(model + ".json"); err == nil {
+		_ = json.Unmarshal(data, &config)
+	}
+	return config
+}
+
+func voiceID(model string) string {
+	return strings.TrimSuffix(filepath.Base(model), ".onnx")
+}
+
+func (p *piper) model(voice string) (string, error) {
+	def := p.opts.Param("model", "")
+	switch {
+	case voice == "":
+		if def == "" {
+			return "", errors.New("tts: piper needs a voice or model")
+		}
+		return def, nil
+	case def != "" && voice == voiceID(def):
+		return def, nil
+	}
+	unknown := fmt.Errorf("%w: %q", ErrUnknownVoice, voice)
+	if filepath.Base(voice) != voice || strings.ContainsAny(voice, `/\`) || strings.HasPrefix(voice, ".") {
+		return "", unknown
+	}
+	model := filepath.Join(p.opts.Param("voices_dir", "."), voice+".onnx")
+	if fi, err := os.Stat(model); err != nil || !fi.Mode().IsRegular() {
+		return "", unknown
+	}
+	return model, nil
+}
+
+func (p *piper) checkVoice(_ context.Context, voice string) error {
+	_, err := p.model(voice)
+	return err
+}
+
+func (p *piper) Voices(context.Context) ([]protocol.Voice, error) {
+	models, err := filepath.Glob(filepath.Join(p.opts.Param("voices_dir", "."), "*.onnx"))
+	if err != nil {
+		return nil, err
+	}
+	if def := p.opts.Param("model", ""); def != "" && !containsID(models, voiceID(def)) {
+		models = append(models, def)
+	}
+	voices := make([]protocol.Voice, 0, len(models))
+	for _, model := range models {
+		config := loadPiperConfig(model)
+		v := protocol.Voice{ID: voiceID(model), Name: config.Dataset, SampleRate: config.Audio.SampleRate}
+		if config.Language.Code != "" {
+			v.Languages = []string{config.Language.Code}
+		}
+		if config.Audio.Quality != "" {
+			v.Tags = append(v.Tags, config.Audio.Quality)
+		}
+		if config.NumSpeakers > 1 {
+			v.Tags = append(v.Tags, "multi-speaker")
+		}
+		voices = append(voices, v)
+	}
+	sort.Slice(voices, func(i, j int) bool { return voices[i].ID < voices[j].ID })
+	return voices, nil
+}
+
+func containsID(models []string, id string) bool {
+	for _, m := range models {
+		if voiceID(m) == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *piper) sampleRate(model string) (int, error) {
+	if v := p.opts.Param("sample_rate", ""); v != "" {
+		return strconv.Atoi(v)
+	}
+	if rate := loadPiperConfig(model).Audio.SampleRate; rate > 0 {
+		return rate, nil
+	}
+	return 22050, nil
+}
+
+func (p *piper) Synthesize(ctx context.Context, req Request, format audio.Format) (audio.Source, error) {
+	req = req.withDefaults(p.opts)
+	model, err := p.model(req.Voice)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := p.sampleRate(model)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--model", model, "--output_raw"}
+	if req.Rate != 1 {
+		args = append(args, "--length_scale", strconv.FormatFloat(1/req.Rate, 'f', 3, 64))
+	}
+	if speaker := p.opts.Param("speaker", ""); speaker != "" {
+		args = append(args, "--speaker", speaker)
+	}
+	src, err := startCommand(ctx, req.Text, p.cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	src.format = audio.Format{SampleRate: rate, Channels: 1, Encoding: protocol.FormatS16LE}
+	return convert(src, format)
+}
+
+// convert wraps src so it produces format, closing src on failure.
+func convert(src audio.Source, format audio.Format) (audio.Source, error) {
+	out, err := audio.ConvertSource(src, format)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,123 @@
+package tts
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Segmenter splits text that arrives in pieces, such as tokens from a
+// language model, into sentences so each can be synthesized as soon as it
+// is complete.
+type Segmenter struct {
+	// MaxLength, if positive, splits a sentence longer than this many
+	// bytes at its last clause break or space.
+	MaxLength int
+
+	buf string
+}
+
+// Write adds text and returns the sentences it completed, if any.
+func (s *Segmenter) Write(text string) []string {
+	s.buf += text
+	var out []string
+	for {
+		end := sentenceEnd(s.buf)
+		if end < 0 && s.MaxLength > 0 && len(s.buf) > s.MaxLength {
+			end = clauseEnd(s.buf, s.MaxLength)
+		}
+		if end < 0 {
+			return out
+		}
+		if seg := strings.TrimSpace(s.buf[:end]); seg != "" {
+			out = append(out, seg)
+		}
+		s.buf = s.buf[end:]
+	}
+}
+
+// Flush returns the text left over, which may be empty, and resets s.
+func (s *Segmenter) Flush() string {
+	seg := strings.TrimSpace(s.buf)
+	s.buf = ""
+	return seg
+}
+
+const (
+	terminators = ".!?…"
+	fullWidth   = "。！？"
+	closers     = "\"'”’)]」』）"
+)
+
+// sentenceEnd returns the offset just past the first sentence in text, or
+// -1 if text does not yet hold a complete one. After ".", "!" or "?" the
+// sentence only ends once whitespace follows, so "3." may still become
+// "3.5" and a chunk ending in "." waits for the next.
+func sentenceEnd(text string) int {
+	for i, r := range text {
+		size := utf8.RuneLen(r)
+		switch {
+		case r == '\n':
+			return i + size
+		case strings.ContainsRune(fullWidth, r):
+			rest := text[i+size:]
+			return len(text) - len(strings.TrimLeft(rest, closers))
+		case strings.ContainsRune(terminators, r):
+			rest := text[i+size:]
+			j := len(text) - len(strings.TrimLeft(rest, terminators+closers))
+			if j == len(text) {
+				return -1
+			}
+			if next, _ := utf8.DecodeRuneInString(text[j:]); !unicode.IsSpace(next) {
+				continue
+			}
+			if r == '.' && abbreviation(text[:i]) {
+				continue
+			}
+			return j
+		}
+	}
+	return -1
+}
+
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true,
+	"st": true, "vs": true, "e.g": true, "i.e": true, "no": true,
+}
+
+// abbreviation reports whether the word before a "." is one that does not
+// end a sentence: a title, an initial, or a list number such as "2.".
+func abbreviation(before string) bool {
+	word := before[strings.LastIndexAny(before, " \t\n(")+1:]
+	if word == "" {
+		return false
+	}
+	if strings.TrimSpace(before) == word && strings.Trim(word, "0123456789") == "" {
+		return true
+	}
+	if r, size := utf8.DecodeRuneInString(word); size == len(word) && unicode.IsUpper(r) {
+		return true
+	}
+	return abbreviations[strings.ToLower(word)]
+}
+
+// clauseEnd picks where to cut an overlong sentence: after the last
+// ",", ";" or ":" within max bytes, else after the last space, else at max
+// bytes rounded down to a rune boundary but at least one rune.
+func clauseEnd(text string, max int) int {
+	head := text[:max]
+	if i := strings.LastIndexAny(head, ",;:"); i > 0 {
+		return i + 1
+	}
+	if i := strings.LastIndexFunc(head, unicode.IsSpace); i > 0 {
+		return i + 1
+	}
+	for max > 0 && !utf8.RuneStart(text[max]) {
+		max--
+	}
+	if max == 0 {
+		// Never cut less than one rune, or Write would make no progress.
+		_, max = utf8.DecodeRuneInString(text)
+	}
+	return max
+}
@@ -0,0 +1,68 @@
+package tts
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func segmentAll(s *Segmenter, chunks ...string) []string {
+	var out []string
+	for _, c := range chunks {
+		out = append(out, s.Write(c)...)
+	}
+	if rest := s.Flush(); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+func TestSegmenter(t *testing.T) {
+	cases := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{"sentences", []string{"Hello there. How are you? Fine!"}, []string{"Hello there.", "How are you?", "Fine!"}},
+		{"split tokens", []string{"Hel", "lo.", " It is 3", ".5 degrees", ". Bye"}, []string{"Hello.", "It is 3.5 degrees.", "Bye"}},
+		{"abbreviations", []string{"Dr. Smith met J. Doe, e.g. at noon. Then left."}, []string{"Dr. Smith met J. Doe, e.g. at noon.", "Then left."}},
+		{"list", []string{"1. First item\n2. Second"}, []string{"1. First item", "2. Second"}},
+		{"quotes and ellipsis", []string{`He said "stop!" Then... silence. `}, []string{`He said "stop!"`, "Then...", "silence."}},
+		{"full width", []string{"你好。再见！"}, []string{"你好。", "再见！"}},
+		{"whitespace only", []string{"  ", "\n\n"}, nil},
+	}
+	for _, c := range cases {
+		if got := segmentAll(&Segmenter{}, c.chunks...); !slices.Equal(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSegmenterEmitsEarly(t *testing.T) {
+	var s Segmenter
+	if got := s.Write("First sentence."); got != nil {
+		t.Errorf("sentence emitted before what follows is known: %q", got)
+	}
+	if got := s.Write(" Second"); !slices.Equal(got, []string{"First sentence."}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSegmenterMaxLength(t *testing.T) {
+	s := Segmenter{MaxLength: 20}
+	got := segmentAll(&s, "one two three, four five six seven eight nine ten")
+	for _, seg := range got {
+		if len(seg) > 20 {
+			t.Errorf("segment %q longer than 20 bytes", seg)
+		}
+	}
+	if got[0] != "one two three," || strings.Join(got, " ") != "one two three, four five six seven eight nine ten" {
+		t.Errorf("got %q", got)
+	}
+	if got := segmentAll(&Segmenter{MaxLength: 4}, "ääääää"); !slices.Equal(got, []string{"ää", "ää", "ää"}) {
+		t.Errorf("cut inside a rune: %q", got)
+	}
+	if got := segmentAll(&Segmenter{MaxLength: 1}, "ää"); !slices.Equal(got, []string{"ä", "ä"}) {
+		t.Errorf("max inside the first rune: %q", got)
+	}
+}
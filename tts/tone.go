@@ -0,0 +1,58 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ion/audio"
+	"ion/protocol"
+)
+
+// The tone backend stands in for a real synthesizer: it plays a 660 Hz
+// tone whose length follows the text, from 0.6 to 4 seconds at rate 1.
+// Params:
+//
+//	freq  tone frequency in Hz (default 660)
+type tone struct {
+	opts Options
+	freq string
+}
+
+func newTone(opts Options) (Synthesizer, error) {
+	return &tone{opts: opts, freq: opts.Param("freq", "660")}, nil
+}
+
+func (t *tone) Synthesize(ctx context.Context, req Request, format audio.Format) (audio.Source, error) {
+	req = req.withDefaults(t.opts)
+	length := 0.6 + float64(len(req.Text))*0.04
+	length = min(max(length, 0.6), 4.0) / req.Rate
+	d := time.Duration(length * float64(time.Second)).Round(time.Millisecond)
+	src, err := audio.OpenSynth(fmt.Sprintf("sine?freq=%s&amp=0.2&duration=%v&realtime=false", t.freq, d), format)
+	if err != nil {
+		return nil, err
+	}
+	return withContext(ctx, src), nil
+}
+
+// Voices lists the single voice the tone backend has.
+func (t *tone) Voices(context.Context) ([]protocol.Voice, error) {
+	return []protocol.Voice{{ID: "default", Name: "Test tone", Tags: []string{"tone"}}}, nil
+}
+
+// withContext makes src fail with ctx's error once ctx is done.
+func withContext(ctx context.Context, src audio.Source) audio.Source {
+	return &ctxSource{Source: src, ctx: ctx}
+}
+
+type ctxSource struct {
+	audio.Source
+	ctx context.Context
+}
+
+func (s *ctxSource) Read(p []byte) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.Source.Read(p)
+}
@@ -0,0 +1,115 @@
+// Package tts defines the speech synthesizer interface used by ION servers
+// and a registry of named backends.
+package tts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"ion/audio"
+)
+
+var ErrUnknownBackend = errors.New("tts: unknown backend")
+
+// Request is one utterance to speak. Empty fields take the Synthesizer's
+// defaults.
+type Request struct {
+	Text     string
+	Voice    string
+	Language string
+	Rate     float64 // speaking rate; 1 is normal, 0 means default
+}
+
+// Synthesizer turns text into speech. It may serve many requests at once.
+type Synthesizer interface {
+	// Synthesize starts speaking req and returns its audio in format.
+	// Audio is produced as fast as the backend allows; pacing is up to
+	// the caller. Cancelling ctx stops synthesis, as does closing the
+	// returned Source.
+	Synthesize(ctx context.Context, req Request, format audio.Format) (audio.Source, error)
+}
+
+type Options struct {
+	Voice    string // used when a Request has none
+	Language string
+
+	// Params holds backend settings such as command paths; each backend
+	// documents the keys it reads.
+	Params map[string]string
+}
+
+// Param returns Params[key], or def if it is unset.
+func (o Options) Param(key, def string) string {
+	if v, ok := o.Params[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// Factory creates a Synthesizer.
+type Factory func(opts Options) (Synthesizer, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("tone", newTone)
+	Register("piper", newPiper)
+	Register("espeak-ng", newEspeak)
+}
+
+// Register makes a backend available to New under name. Registering a
+// name twice panics.
+func Register(name string, f Factory) {
+	if name == "" || f == nil {
+		panic("tts: Register with empty name or nil factory")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("tts: backend %q already registered", name))
+	}
+	registry[name] = f
+}
+
+// Backends lists the registered backend names.
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates a Synthesizer from the named backend.
+func New(name string, opts Options) (Synthesizer, error) {
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+	return f(opts)
+}
+
+// withDefaults fills empty request fields from opts.
+func (r Request) withDefaults(opts Options) Request {
+	if r.Voice == "" {
+		r.Voice = opts.Voice
+	}
+	if r.Language == "" {
+		r.Language = opts.Language
+	}
+	if r.Rate <= 0 {
+		r.Rate = 1
+	}
+	return r
+}
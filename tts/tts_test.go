@@ -0,0 +1,246 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ion/audio"
+	"ion/audio/wav"
+	"ion/protocol"
+)
+
+var stereo16k = audio.Format{SampleRate: 16000, Channels: 2, Encoding: protocol.FormatS16LE}
+
+// script writes an executable shell script into dir.
+func script(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readAll(t *testing.T, src audio.Source) []byte {
+	t.Helper()
+	defer src.Close()
+	pcm, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pcm
+}
+
+func TestRegistry(t *testing.T) {
+	for _, name := range []string{"tone", "piper", "espeak-ng"} {
+		if !slices.Contains(Backends(), name) {
+			t.Errorf("backend %q not registered", name)
+		}
+	}
+	if _, err := New("nope", Options{}); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("unknown backend: got %v", err)
+	}
+}
+
+func TestTone(t *testing.T) {
+	s, _ := New("tone", Options{})
+	src, err := s.Synthesize(context.Background(), Request{Text: "hello"}, stereo16k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(readAll(t, src)); got != 12800*4 {
+		t.Errorf("got %d bytes, want 0.8s", got)
+	}
+	src, _ = s.Synthesize(context.Background(), Request{Text: "hello", Rate: 2}, stereo16k)
+	if got := len(readAll(t, src)); got != 6400*4 {
+		t.Errorf("rate 2: got %d bytes, want 0.4s", got)
+	}
+}
+
+func TestPiper(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "en_US-test.onnx"), nil, 0o644)
+	os.WriteFile(filepath.Join(dir, "en_US-test.onnx.json"), []byte(`{"audio": {"sample_rate": 22050}}`), 0o644)
+	cmd := script(t, dir, "piper", `echo "$@" > "`+dir+`/args"
+cat > "`+dir+`/text"
+head -c 44100 /dev/zero
+`)
+	s, _ := New("piper", Options{Params: map[string]string{"cmd": cmd, "voices_dir": dir}})
+	src, err := s.Synthesize(context.Background(), Request{Text: "hello there", Voice: "en_US-test", Rate: 2}, stereo16k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(readAll(t, src)); got != 16000*4 {
+		t.Errorf("got %d bytes, want one second at 16 kHz stereo", got)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	want := "--model " + filepath.Join(dir, "en_US-test.onnx") + " --output_raw --length_scale 0.500"
+	if strings.TrimSpace(string(args)) != want {
+		t.Errorf("args %q, want %q", args, want)
+	}
+	if text, _ := os.ReadFile(filepath.Join(dir, "text")); string(text) != "hello there\n" {
+		t.Errorf("stdin %q", text)
+	}
+
+	if _, err := (&piper{}).model(""); err == nil {
+		t.Error("no voice or model accepted")
+	}
+}
+
+func TestEspeak(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := wav.Encode(wav.Header{SampleRate: 22050, Channels: 1, Format: protocol.FormatS16LE}, make([]byte, 22050))
+	os.WriteFile(filepath.Join(dir, "out.wav"), data, 0o644)
+	cmd := script(t, dir, "espeak-ng", `echo "$@" > "`+dir+`/args"
+cat "`+dir+`/out.wav"
+`)
+	s, _ := New("espeak-ng", Options{Params: map[string]string{"cmd": cmd}})
+	src, err := s.Synthesize(context.Background(), Request{Text: "hallo", Language: "de"}, stereo16k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(readAll(t, src)); got != 8000*4 {
+		t.Errorf("got %d bytes, want half a second at 16 kHz stereo", got)
+	}
+	if args, _ := os.ReadFile(filepath.Join(dir, "args")); strings.TrimSpace(string(args)) != "--stdout --stdin -s 175 -v de" {
+		t.Errorf("args %q", args)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	failing := script(t, dir, "fail", "echo 'voice not found' >&2\nexit 1\n")
+
+	s, _ := New("espeak-ng", Options{Params: map[string]string{"cmd": failing}})
+	if _, err := s.Synthesize(context.Background(), Request{Text: "x"}, stereo16k); err == nil || !strings.Contains(err.Error(), "voice not found") {
+		t.Errorf("espeak: got %v", err)
+	}
+
+	s, _ = New("piper", Options{Params: map[string]string{"cmd": failing, "model": "x.onnx"}})
+	src, err := s.Synthesize(context.Background(), Request{Text: "x"}, stereo16k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(src); err == nil || !strings.Contains(err.Error(), "voice not found") {
+		t.Errorf("piper: got %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	dir := t.TempDir()
+	slow := script(t, dir, "piper", "head -c 4410 /dev/zero\nexec sleep 10\n")
+	s, _ := New("piper", Options{Params: map[string]string{"cmd": slow, "model": "x.onnx"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	src, err := s.Synthesize(ctx, Request{Text: "x"}, stereo16k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	buf := make([]byte, 640)
+	if _, err := src.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	cancel()
+	for err == nil {
+		_, err = src.Read(buf)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("cancel took %v", time.Since(start))
+	}
+}
+
+func TestPiperVoices(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "de_DE-thorsten-high.onnx"), nil, 0o644)
+	os.WriteFile(filepath.Join(dir, "de_DE-thorsten-high.onnx.json"), []byte(`{
+		"audio": {"sample_rate": 22050, "quality": "high"},
+		"language": {"code": "de_DE"},
+		"dataset": "thorsten",
+		"num_speakers": 2
+	}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "en_US-test.onnx"), nil, 0o644)
+	s, _ := New("piper", Options{Params: map[string]string{"voices_dir": dir}})
+
+	voices, err := Voices(context.Background(), s, "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []protocol.Voice{{
+		ID: "de_DE-thorsten-high", Name: "thorsten", Languages: []string{"de_DE"},
+		Tags: []string{"high", "multi-speaker"}, SampleRate: 22050,
+	}}
+	if len(voices) != 1 || !slices.Equal(voices[0].Tags, want[0].Tags) || voices[0].ID != want[0].ID ||
+		voices[0].SampleRate != want[0].SampleRate || voices[0].Name != want[0].Name {
+		t.Errorf("got %+v, want %+v", voices, want)
+	}
+	if voices, _ := Voices(context.Background(), s, ""); len(voices) != 2 {
+		t.Errorf("got %d voices, want 2", len(voices))
+	}
+
+	if err := CheckVoice(context.Background(), s, "en_US-test"); err != nil {
+		t.Error(err)
+	}
+	outside := filepath.Join(t.TempDir(), "evil.onnx")
+	os.WriteFile(outside, nil, 0o644)
+	rel, _ := filepath.Rel(dir, outside)
+	for _, voice := range []string{"fr_FR-nope", outside, rel, strings.TrimSuffix(rel, ".onnx"), "en_US-test.onnx", ".", ".."} {
+		if err := CheckVoice(context.Background(), s, voice); !errors.Is(err, ErrUnknownVoice) {
+			t.Errorf("voice %q: got %v", voice, err)
+		}
+	}
+	if _, err := s.Synthesize(context.Background(), Request{Text: "x", Voice: "fr_FR-nope"}, stereo16k); !errors.Is(err, ErrUnknownVoice) {
+		t.Errorf("synthesize unknown voice: got %v", err)
+	}
+}
+
+func TestEspeakVoices(t *testing.T) {
+	dir := t.TempDir()
+	cmd := script(t, dir, "espeak-ng", `cat <<'EOT'
+Pty Language       Age/Gender VoiceName          File                 Other Languages
+ 5  de              --/M      German             gmw/de
+ 2  en-gb           --/M      English_(Great_Britain) gmw/en            (en 2)
+ 5  en-us           --/F      English_(America)  gmw/en-US            (en 3)
+EOT
+`)
+	s, _ := New("espeak-ng", Options{Params: map[string]string{"cmd": cmd}})
+	voices, err := Voices(context.Background(), s, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(voices) != 2 {
+		t.Fatalf("got %+v, want en-gb and en-us", voices)
+	}
+	v := voices[1]
+	if v.ID != "en-us" || v.Name != "English (America)" || v.Gender != "female" ||
+		!slices.Equal(v.Languages, []string{"en-us", "en"}) || v.SampleRate != 22050 {
+		t.Errorf("got %+v", v)
+	}
+
+	for voice, ok := range map[string]bool{"de": true, "en-us+f3": true, "German": true, "xx": false} {
+		if err := CheckVoice(context.Background(), s, voice); (err == nil) != ok {
+			t.Errorf("CheckVoice(%q) = %v", voice, err)
+		}
+	}
+}
+
+func TestToneVoices(t *testing.T) {
+	s, _ := New("tone", Options{})
+	if err := CheckVoice(context.Background(), s, "default"); err != nil {
+		t.Error(err)
+	}
+	if err := CheckVoice(context.Background(), s, "alice"); !errors.Is(err, ErrUnknownVoice) {
+		t.Errorf("got %v", err)
+	}
+}
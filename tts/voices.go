@@ -0,0 +1,71 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"ion/protocol"
+)
+
+var ErrUnknownVoice = errors.New("tts: unknown voice")
+
+// VoiceLister is implemented by Synthesizers that can list their voices.
+type VoiceLister interface {
+	Voices(ctx context.Context) ([]protocol.Voice, error)
+}
+
+// voiceChecker is implemented by Synthesizers that accept more voice names
+// than they list, such as espeak-ng variants.
+type voiceChecker interface {
+	checkVoice(ctx context.Context, voice string) error
+}
+
+// Voices lists the voices of s that speak language, or all of them if
+// language is empty. A Synthesizer that cannot list voices has none.
+func Voices(ctx context.Context, s Synthesizer, language string) ([]protocol.Voice, error) {
+	l, ok := s.(VoiceLister)
+	if !ok {
+		return nil, nil
+	}
+	voices, err := l.Voices(ctx)
+	if err != nil || language == "" {
+		return voices, err
+	}
+	var out []protocol.Voice
+	for _, v := range voices {
+		if v.Speaks(language) {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// CheckVoice returns ErrUnknownVoice if s lists its voices and voice is not
+// among them. An empty voice, meaning the default, is always accepted.
+func CheckVoice(ctx context.Context, s Synthesizer, voice string) error {
+	if voice == "" {
+		return nil
+	}
+	if c, ok := s.(voiceChecker); ok {
+		return c.checkVoice(ctx, voice)
+	}
+	l, ok := s.(VoiceLister)
+	if !ok {
+		return nil
+	}
+	return findVoice(ctx, l, voice)
+}
+
+func findVoice(ctx context.Context, l VoiceLister, voice string) error {
+	voices, err := l.Voices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, v := range voices {
+		if v.ID == voice {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownVoice, voice)
+}